@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/stats"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// assertOps are the comparison operators of the assertions, the two-character
+// operators are matched first.
+var assertOps = []string{"<=", ">=", "==", "!=", "<", ">", "="}
+
+// assertion is an assertion of `--assert` checked after the run. It is either
+// a metric of the final summary compared with a value, such as `p99<50ms`,
+// `qps>1000`, `errors.write-conflict==0` and `get.p99<10ms` (the breakdown
+// of the statement or endpoint), or a query which returns one value, such as
+// `select count(*) from t = 100`.
+type assertion struct {
+	expr   string
+	metric string
+	query  string
+	op     string
+	value  string
+}
+
+// parseAssertion parses the assertion, the last comparison operator splits
+// the expression, so the query can contain the operators too.
+func parseAssertion(expr string) (*assertion, error) {
+	a := &assertion{expr: strings.TrimSpace(expr)}
+	idx := strings.LastIndexAny(a.expr, "<>=!")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid assertion: %v, should be such as p99<50ms or select count(*) from t = 100", expr)
+	}
+	for _, op := range assertOps {
+		start := idx + 1 - len(op)
+		if start > 0 && a.expr[start:idx+1] == op {
+			a.op, idx = op, start
+			break
+		}
+	}
+	if a.op == "" {
+		return nil, fmt.Errorf("invalid operator of assertion: %v", expr)
+	}
+	left := strings.TrimSpace(a.expr[:idx])
+	a.value = strings.TrimSpace(a.expr[idx+len(a.op):])
+	if left == "" || a.value == "" {
+		return nil, fmt.Errorf("invalid assertion: %v", expr)
+	}
+	if strings.HasPrefix(strings.ToLower(left), "select ") {
+		a.query = left
+		return a, nil
+	}
+	a.metric = strings.ToLower(left)
+	if !validMetric(a.metric) {
+		return nil, fmt.Errorf("unknown metric of assertion %v, should be one of %v, errors.<class>, or <statement>.<metric>", expr, strings.Join(assertMetrics, ", "))
+	}
+	if isLatencyMetric(a.metric) {
+		if _, err := parseLatency(a.value); err != nil {
+			return nil, fmt.Errorf("invalid latency %v of assertion %v", a.value, expr)
+		}
+	} else if _, err := strconv.ParseFloat(a.value, 64); err != nil {
+		return nil, fmt.Errorf("invalid number %v of assertion %v", a.value, expr)
+	}
+	return a, nil
+}
+
+// check returns the result of the assertion, db is only used by the query assertions.
+func (a *assertion) check(ctx context.Context, s stats.Summary, db func() (*sql.DB, error)) stats.Assertion {
+	result := stats.Assertion{Expr: a.expr}
+	if a.query != "" {
+		conn, err := db()
+		if err == nil {
+			var value sql.NullString
+			err = conn.QueryRowContext(ctx, a.query).Scan(&value)
+			result.Actual = value.String
+			if !value.Valid {
+				result.Actual = "NULL"
+			}
+		}
+		if err != nil {
+			result.Actual = "error: " + err.Error()
+			return result
+		}
+		result.Passed = compareValues(result.Actual, a.op, a.value)
+		return result
+	}
+	actual, err := a.metricValue(s)
+	if err != nil {
+		result.Actual = "error: " + err.Error()
+		return result
+	}
+	if isLatencyMetric(a.metric) {
+		expected, _ := parseLatency(a.value)
+		d := time.Duration(actual)
+		result.Actual = d.String()
+		result.Passed = compareFloats(float64(d), a.op, float64(expected))
+		return result
+	}
+	expected, _ := strconv.ParseFloat(a.value, 64)
+	result.Actual = strconv.FormatFloat(math.Round(actual*1000)/1000, 'f', -1, 64)
+	result.Passed = compareFloats(actual, a.op, expected)
+	return result
+}
+
+// assertMetrics are the metrics of the summary which can be asserted.
+var assertMetrics = []string{"qps", "count", "errors", "avg", "p50", "p90", "p95", "p99", "p999", "max"}
+
+// splitMetric splits the metric into the breakdown name and the metric of the breakdown.
+func splitMetric(metric string) (string, string) {
+	if strings.HasPrefix(metric, "errors.") {
+		return "", metric
+	}
+	if idx := strings.LastIndex(metric, "."); idx > 0 {
+		return metric[:idx], metric[idx+1:]
+	}
+	return "", metric
+}
+
+func validMetric(metric string) bool {
+	_, metric = splitMetric(metric)
+	if strings.HasPrefix(metric, "errors.") {
+		return true
+	}
+	for _, m := range assertMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// metricValue returns the metric of the summary, the latency is in nanoseconds.
+func (a *assertion) metricValue(s stats.Summary) (float64, error) {
+	name, metric := splitMetric(a.metric)
+	if name != "" {
+		found := false
+		for _, sub := range s.Subs {
+			if strings.EqualFold(sub.Name, name) {
+				s, found = sub, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("no statement or endpoint %v", name)
+		}
+	}
+	if strings.HasPrefix(metric, "errors.") {
+		class := strings.Replace(strings.TrimPrefix(metric, "errors."), "_", "-", -1)
+		return float64(s.Errors[class]), nil
+	}
+	switch metric {
+	case "qps":
+		return s.QPS, nil
+	case "count":
+		return float64(s.Count), nil
+	case "errors":
+		var total int64
+		for _, n := range s.Errors {
+			total += n
+		}
+		return float64(total), nil
+	case "avg":
+		return float64(s.Avg), nil
+	case "p50":
+		return float64(s.P50), nil
+	case "p90":
+		return float64(s.P90), nil
+	case "p95":
+		return float64(s.P95), nil
+	case "p99":
+		return float64(s.P99), nil
+	case "p999":
+		return float64(s.P999), nil
+	case "max":
+		return float64(s.Max), nil
+	}
+	return 0, fmt.Errorf("unknown metric %v", metric)
+}
+
+func isLatencyMetric(metric string) bool {
+	_, metric = splitMetric(metric)
+	switch metric {
+	case "avg", "p50", "p90", "p95", "p99", "p999", "max":
+		return true
+	}
+	return false
+}
+
+// parseLatency parses the latency such as 50ms, the number without unit is in milliseconds.
+func parseLatency(s string) (time.Duration, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(v * float64(time.Millisecond)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+func compareFloats(actual float64, op string, expected float64) bool {
+	switch op {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "!=":
+		return actual != expected
+	default:
+		return actual == expected
+	}
+}
+
+// compareValues compares the values as numbers if both are numbers, otherwise as strings.
+func compareValues(actual, op, expected string) bool {
+	expected = strings.Trim(expected, `'"`)
+	a, errA := strconv.ParseFloat(actual, 64)
+	e, errE := strconv.ParseFloat(expected, 64)
+	if errA == nil && errE == nil {
+		return compareFloats(a, op, e)
+	}
+	switch op {
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	case ">=":
+		return actual >= expected
+	case "!=":
+		return actual != expected
+	default:
+		return actual == expected
+	}
+}
+
+// AssertionError is returned if any assertion of the run failed, the program
+// exits with a different code from the other errors.
+type AssertionError struct {
+	Failed []string
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("%v assertion(s) failed: %v", len(e.Failed), strings.Join(e.Failed, "; "))
+}
@@ -1,27 +1,21 @@
 package cmd
 
 import (
-	"database/sql"
 	"fmt"
+	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
-	"math/rand"
-	"os"
 	"strconv"
-	"strings"
-	"sync/atomic"
-	"time"
 )
 
 type BenchSQL struct {
 	*App
-	query  string
-	ignore bool
+	query    string
+	workload string
+	mode     string
+	ignore   bool
 
-	valMin     int64
-	valMax     int64
-	currentVal int64
-
-	totalQPS int64
+	valMin int64
+	valMax int64
 }
 
 const randValueStr = "#rand-val"
@@ -37,10 +31,12 @@ func (b *BenchSQL) Cmd() *cobra.Command {
 	}
 
 	//cmd.Flags().IntVar(&app.EstimateTableRows, "new-table-row", 0, "estimate need be split table rows")
-	cmd.Flags().StringVarP(&b.query, "sql", "", "", "bench sql statement")
-	cmd.Flags().BoolVarP(&b.ignore, "ignore", "", false, "should ignore error?")
-	cmd.Flags().Int64VarP(&b.valMin, "valmin", "", 0, randValueStr +"/"+seqValueStr +" min val")
-	cmd.Flags().Int64VarP(&b.valMax, "valmax", "", 0, randValueStr +"/"+seqValueStr + " max val")
+	cmd.Flags().StringVarP(&b.query, "sql", "", "", "bench sql statement, it supports placeholders such as {{id:int(1,100)}}, {{str(10)}} and {{id}}")
+	cmd.Flags().StringVarP(&b.workload, "workload", "", "", "bench workload file, which specifies the weighted statements in yaml")
+	cmd.Flags().StringVarP(&b.mode, "mode", "", ModeText, "how to send the statements: text, prepare (prepare and execute every time) or prepare-once (prepare once per worker)")
+	cmd.Flags().BoolVarP(&b.ignore, "ignore", "", false, "should ignore error? it's the same as --error-policy default=continue")
+	cmd.Flags().Int64VarP(&b.valMin, "valmin", "", 0, randValueStr+"/"+seqValueStr+" min val")
+	cmd.Flags().Int64VarP(&b.valMax, "valmax", "", 0, randValueStr+"/"+seqValueStr+" max val")
 
 	return cmd
 }
@@ -48,8 +44,12 @@ func (b *BenchSQL) Cmd() *cobra.Command {
 func (b *BenchSQL) validateParas(cmd *cobra.Command) error {
 	msg := "need specify `%s` parameter"
 	var err error
-	if b.query == "" {
-		err = fmt.Errorf(msg, "sql")
+	if b.query == "" && b.workload == "" {
+		err = fmt.Errorf(msg, "sql` or `workload")
+	} else if b.query != "" && b.workload != "" {
+		err = fmt.Errorf("`sql` and `workload` parameter can't be specified at the same time")
+	} else if b.mode != ModeText && b.mode != ModePrepare && b.mode != ModePrepareOnce {
+		err = fmt.Errorf("unknown mode: %v", b.mode)
 	}
 	return err
 }
@@ -60,59 +60,44 @@ func (b *BenchSQL) RunE(cmd *cobra.Command, args []string) error {
 		fmt.Printf("-----------[ help ]-----------\n")
 		return cmd.Help()
 	}
-	fmt.Printf("sql: %v\nconcurrency: %v\n", b.replaceSQL(b.query), b.cfg.Concurrency)
-	//b.currentVal = b.valMin
-	for i := 0; i < b.cfg.Concurrency; i++ {
-		go b.benchSql()
-	}
-	start := time.Now()
-	for {
-		time.Sleep(1 * time.Second)
-		fmt.Printf("qps: %v\n", int64(float64(atomic.LoadInt64(&b.totalQPS))/time.Since(start).Seconds()))
-	}
-}
-
-func (b *BenchSQL) benchSql() {
-	db := b.GetSQLCli()
-	sqlStr := b.query
-	for {
-		batch := 20
+	var workload *Workload
+	if b.workload != "" {
 		var err error
-		var rows *sql.Rows
-		for i := 0; i < batch; i++ {
-			sqlStr = b.replaceSQL(b.query)
-			if strings.HasPrefix(strings.ToLower(sqlStr), "select") {
-				rows, err = db.Query(sqlStr)
-			} else {
-				_, err = db.Exec(sqlStr)
-			}
-			if err != nil && !b.ignore {
-				fmt.Printf("exec: %v, err: %v\n", sqlStr, err)
-				os.Exit(-1)
-			}
-			if rows != nil {
-				for rows.Next() {
-				}
-				rows.Close()
-			}
+		workload, err = LoadWorkload(b.workload, b.valMin, b.valMax)
+		if err != nil {
+			return err
+		}
+		for _, s := range workload.Statements {
+			fmt.Printf("statement: %v, weight: %v\n", s.Name, s.Weight)
 		}
-		atomic.AddInt64(&b.totalQPS, int64(batch))
+		fmt.Printf("concurrency: %v\n", b.concurrency())
+	} else {
+		var err error
+		workload, err = NewSingleWorkload(b.query, b.valMin, b.valMax)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("sql: %v\nconcurrency: %v\n", b.query, b.concurrency())
+	}
+	workload.Mode = b.mode
+	workload.Seed = b.cfg.Seed
+	fmt.Printf("seed: %v\n", b.cfg.Seed)
+	runner := NewRunner(b.cfg)
+	if b.ignore {
+		runner.DefaultErrorPolicy("default", util.ErrPolicyContinue)
 	}
+	return runner.Run(func(id int) (Worker, error) {
+		conn, err := runner.Conn()
+		if err != nil {
+			return nil, err
+		}
+		return workload.NewWorker(id, conn), nil
+	})
 }
 
-func(b *BenchSQL) replaceSQL(sql string) string {
-	if b.valMin == b.valMax {
-		return sql
+func (b *BenchSQL) concurrency() string {
+	if b.cfg.Ramp != "" {
+		return "ramp " + b.cfg.Ramp
 	}
-	if strings.Contains(sql, randValueStr) {
-		rand.Seed(time.Now().UnixNano())
-		v := rand.Intn(int(b.valMax-b.valMin+1)) + int(b.valMin)
-		return strings.Replace(sql,randValueStr,strconv.Itoa(v),-1)
-	}
-	if strings.Contains(sql, seqValueStr) {
-		v := atomic.AddInt64(&b.currentVal,1)
-		return strings.Replace(sql,seqValueStr,strconv.Itoa(int(v)),-1)
-	}
-
-	return sql
+	return strconv.Itoa(b.cfg.Concurrency)
 }
@@ -1,19 +1,64 @@
 package cmd
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/data"
+	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
+	"math/rand"
+	"sync"
 )
 
 type CaseTest struct {
 	*App
 }
 
-type CMDGenerater interface {
+// Case is a test case of the `case` command. RunCase calls the phases in order:
+// Setup and Load prepare the schema and the data, the workers created by Workers
+// run beside Report until the run stops, then Verify checks the result. Teardown
+// is always called at last.
+type Case interface {
+	// Cmd returns the command of the case with its flags, RunE of the command is set by the `case` command.
 	Cmd() *cobra.Command
+	// Setup sets the database of the case and creates the tables, it can set the default error policies of env.Runner.
+	Setup(ctx context.Context, env *CaseEnv) error
+	// Load loads the data of the case.
+	Load(ctx context.Context, env *CaseEnv) error
+	// Workers returns the worker of id, conn is the dedicated connection of the worker.
+	Workers(env *CaseEnv, id int, conn *sql.Conn) (Worker, error)
+	// Report prints the information of the case beside the workers until ctx is done.
+	Report(ctx context.Context, env *CaseEnv) error
+	// Verify checks the result after the workers stopped.
+	Verify(ctx context.Context, env *CaseEnv) error
+	// Teardown cleans up the case.
+	Teardown(ctx context.Context, env *CaseEnv) error
 }
 
-var caseCmds = []func(config *config.Config) CMDGenerater{}
+// BaseCase implements the optional phases of Case with nothing to do, the cases
+// can embed it and implement the phases they need.
+type BaseCase struct{}
+
+func (BaseCase) Load(ctx context.Context, env *CaseEnv) error {
+	return nil
+}
+
+func (BaseCase) Report(ctx context.Context, env *CaseEnv) error {
+	return nil
+}
+
+func (BaseCase) Verify(ctx context.Context, env *CaseEnv) error {
+	return nil
+}
+
+func (BaseCase) Teardown(ctx context.Context, env *CaseEnv) error {
+	return nil
+}
+
+var caseCmds = []func(config *config.Config) Case{}
 
 func (b *CaseTest) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -25,8 +70,12 @@ func (b *CaseTest) Cmd() *cobra.Command {
 	}
 
 	for _, gen := range caseCmds {
-		child := gen(b.cfg)
-		cmd.AddCommand(child.Cmd())
+		c := gen(b.cfg)
+		child := c.Cmd()
+		child.RunE = func(cmd *cobra.Command, args []string) error {
+			return RunCase(b.cfg, c)
+		}
+		cmd.AddCommand(child)
 	}
 	return cmd
 }
@@ -35,6 +84,168 @@ func (b *CaseTest) RunE(cmd *cobra.Command, args []string) error {
 	return cmd.Help()
 }
 
-func RegisterCaseCmd(c func(config *config.Config) CMDGenerater) {
+// RegisterCaseCmd registers the constructor of a Case as a sub command of `case`.
+func RegisterCaseCmd(c func(config *config.Config) Case) {
 	caseCmds = append(caseCmds, c)
 }
+
+// RunCase runs the phases of the case with a Runner, the workers and the
+// report of the case have the same stats, stop conditions and output as bench.
+func RunCase(cfg *config.Config, c Case) error {
+	runner := NewRunner(cfg)
+	env := &CaseEnv{Cfg: cfg, Runner: runner}
+	defer env.close()
+	ctx := runner.Context()
+	fmt.Printf("seed: %v\n", cfg.Seed)
+	err := c.Setup(ctx, env)
+	if err == nil {
+		err = c.Load(ctx, env)
+		if err != nil {
+			fmt.Println("prepare data meet error: ", err)
+		}
+	}
+	if err != nil {
+		// the run doesn't start, stop the runner to uninstall the signal handler.
+		runner.stop()
+	} else {
+		fmt.Println("finish prepare data")
+		runErr := runner.Run(func(id int) (Worker, error) {
+			conn, err := runner.Conn()
+			if err != nil {
+				return nil, err
+			}
+			w, err := c.Workers(env, id, conn)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return w, nil
+		}, func(ctx context.Context) error {
+			return c.Report(ctx, env)
+		})
+		// Verify runs even if the run failed, so the checks of the case are always reported.
+		// The context of the runner is done after the run, so the last phases don't use it.
+		err = combineErrors(runErr, c.Verify(context.Background(), env))
+	}
+	if teardownErr := c.Teardown(context.Background(), env); teardownErr != nil && err == nil {
+		err = teardownErr
+	}
+	return err
+}
+
+// combineErrors combines the errors of the run and the verification. The failed
+// assertions of both are merged, otherwise the error which is not an assertion
+// failure decides the exit code and the other is appended to the message.
+func combineErrors(runErr, verifyErr error) error {
+	if runErr == nil {
+		return verifyErr
+	}
+	if verifyErr == nil {
+		return runErr
+	}
+	var runAssert, verifyAssert *AssertionError
+	isRunAssert, isVerifyAssert := errors.As(runErr, &runAssert), errors.As(verifyErr, &verifyAssert)
+	switch {
+	case isRunAssert && isVerifyAssert:
+		failed := append(append([]string{}, runAssert.Failed...), verifyAssert.Failed...)
+		return &AssertionError{Failed: failed}
+	case isRunAssert:
+		return fmt.Errorf("verify error: %w, run error: %v", verifyErr, runErr)
+	default:
+		return fmt.Errorf("%w, verify error: %v", runErr, verifyErr)
+	}
+}
+
+// CaseEnv is the environment of the case phases.
+type CaseEnv struct {
+	Cfg    *config.Config
+	Runner *Runner
+
+	mu sync.Mutex
+	db *sql.DB
+}
+
+// DB returns the connection pool of the case database Cfg.DBName, it is closed after the case finishes.
+func (e *CaseEnv) DB() (*sql.DB, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.db == nil {
+		db, err := util.OpenDB(e.Cfg, e.Cfg.DBName)
+		if err != nil {
+			return nil, err
+		}
+		e.db = db
+	}
+	return e.db, nil
+}
+
+// Exec creates the case database if it doesn't exist and executes sqls in it,
+// all the statements are executed in one connection since `use` only affects
+// the connection.
+func (e *CaseEnv) Exec(ctx context.Context, sqls ...string) error {
+	db, err := util.OpenDB(e.Cfg, "")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ss := []string{
+		"create database if not exists " + e.Cfg.DBName,
+		"use " + e.Cfg.DBName,
+	}
+	for _, s := range append(ss, sqls...) {
+		if _, err := conn.ExecContext(ctx, s); err != nil {
+			return fmt.Errorf("execute %v error: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// TableRows returns the rows count of the table in the case database, ok is
+// false if the table doesn't exist.
+func (e *CaseEnv) TableRows(ctx context.Context, table string) (rows int, ok bool) {
+	db, err := e.DB()
+	if err != nil {
+		return 0, false
+	}
+	err = db.QueryRowContext(ctx, fmt.Sprintf("select count(1) from %v", table)).Scan(&rows)
+	if err != nil {
+		fmt.Printf("table %v doesn't exists\n", table)
+		return 0, false
+	}
+	return rows, true
+}
+
+// Insert loads the values of genRow(i) for i in [0, rows) into the table with
+// the concurrency and the load mode of Cfg, and prints the progress every second.
+// The values are plain numbers and strings of all the columns in the table order.
+func (e *CaseEnv) Insert(ctx context.Context, table string, rows int, genRow func(i int) []interface{}) error {
+	db, err := e.DB()
+	if err != nil {
+		return err
+	}
+	return data.LoadRows(ctx, e.Cfg, db, &data.Rows{
+		Table: table,
+		Count: rows,
+		Gen: func(_ *rand.Rand, i int) []interface{} {
+			return genRow(i)
+		},
+	})
+}
+
+// Rand returns the rand of the id-th worker derived from `--seed`, it is not safe for concurrent use.
+func (e *CaseEnv) Rand(id int) *rand.Rand {
+	return util.NewRand(e.Cfg.Seed, int64(id))
+}
+
+func (e *CaseEnv) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.db != nil {
+		e.db.Close()
+	}
+}
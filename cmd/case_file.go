@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/data"
+	"github.com/crazycs520/testutil/util"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaseFile is the case declared in the file of `case run --file`. The file is
+// YAML, or TOML if the file extension is .toml, such as:
+//
+//	name: transfer
+//	database: case_transfer
+//	concurrency: 20
+//	duration: 1m
+//	tables:
+//	  - name: account
+//	    rows: 10000
+//	    columns:
+//	      - {name: id, type: int}
+//	      - {name: balance, type: bigint, min: 100, max: 100}
+//	    indexes:
+//	      - {type: primary, columns: [id]}
+//	setup:
+//	  - analyze table account
+//	statements:
+//	  - name: transfer
+//	    vars:
+//	      from: int(0, 9999)
+//	      to: int(0, 9999)
+//	    txn:
+//	      - update account set balance = balance - 1 where id = {{from}}
+//	      - update account set balance = balance + 1 where id = {{to}}
+//	error-policy:
+//	  write-conflict: continue
+//	monitors:
+//	  - name: balance
+//	    sql: select sum(balance) from account
+//	    interval: 10s
+//	assert:
+//	  - p99 < 100ms
+//	  - errors.deadlock == 0
+//	  - select sum(balance) from account = 1000000
+//
+// The statements are the same as the workload file of `bench --workload`. The
+// tables are created and loaded if they don't have the expected rows, then the
+// setup statements are executed. Assert are the same as `--assert`, they are
+// checked after the run and reported in the run result.
+type CaseFile struct {
+	Name        string            `yaml:"name" toml:"name"`
+	Database    string            `yaml:"database" toml:"database"`
+	Concurrency int               `yaml:"concurrency" toml:"concurrency"`
+	Duration    time.Duration     `yaml:"duration" toml:"duration"`
+	Tables      []CaseTable       `yaml:"tables" toml:"tables"`
+	Setup       []string          `yaml:"setup" toml:"setup"`
+	Statements  []*WorkloadStmt   `yaml:"statements" toml:"statements"`
+	ErrorPolicy map[string]string `yaml:"error-policy" toml:"error-policy"`
+	Monitors    []CaseQuery       `yaml:"monitors" toml:"monitors"`
+	Assert      []string          `yaml:"assert" toml:"assert"`
+}
+
+// CaseTable is a table of the case file, the columns and the indexes are
+// mapped to data.ColumnDef and data.IndexInfo.
+type CaseTable struct {
+	Name    string       `yaml:"name" toml:"name"`
+	Rows    int          `yaml:"rows" toml:"rows"`
+	Columns []CaseColumn `yaml:"columns" toml:"columns"`
+	Indexes []CaseIndex  `yaml:"indexes" toml:"indexes"`
+}
+
+type CaseColumn struct {
+	Name    string `yaml:"name" toml:"name"`
+	Type    string `yaml:"type" toml:"type"`
+	Default string `yaml:"default" toml:"default"`
+	Min     string `yaml:"min" toml:"min"`
+	Max     string `yaml:"max" toml:"max"`
+	// JSONDepth is the max nesting depth of the generated JSON documents of the JSON column.
+	JSONDepth int `yaml:"json-depth" toml:"json-depth"`
+	// Distribution is the distribution of the generated values, such as zipf:1.2 and hotspot:90,10.
+	Distribution string `yaml:"distribution" toml:"distribution"`
+	// NullRatio is the ratio of the NULL values in [0, 1].
+	NullRatio float64 `yaml:"null-ratio" toml:"null-ratio"`
+	// Correlation makes the column depend on a column before it, such as a or a:10.
+	Correlation string `yaml:"correlation" toml:"correlation"`
+}
+
+// CaseIndex is an index of the table, Type is one of index, unique and primary.
+type CaseIndex struct {
+	Type    string   `yaml:"type" toml:"type"`
+	Columns []string `yaml:"columns" toml:"columns"`
+}
+
+// CaseQuery is a monitoring query of the case file, it is printed every Interval.
+type CaseQuery struct {
+	Name     string        `yaml:"name" toml:"name"`
+	SQL      string        `yaml:"sql" toml:"sql"`
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+}
+
+// LoadCaseFile loads the case file.
+func LoadCaseFile(path string) (*CaseFile, error) {
+	f := &CaseFile{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.DecodeFile(path, f)
+		if err != nil {
+			return nil, fmt.Errorf("parse case file %v error: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("unknown item %v in case file %v", undecoded[0], path)
+		}
+	} else {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(content, f); err != nil {
+			return nil, fmt.Errorf("parse case file %v error: %v", path, err)
+		}
+	}
+	if f.Name == "" {
+		f.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	for _, t := range f.Tables {
+		if t.Name == "" || len(t.Columns) == 0 {
+			return nil, fmt.Errorf("table of case %v should have the name and the columns", f.Name)
+		}
+	}
+	for i := range f.Monitors {
+		if f.Monitors[i].SQL == "" {
+			return nil, fmt.Errorf("monitor %v of case %v doesn't have the sql", f.Monitors[i].Name, f.Name)
+		}
+		if f.Monitors[i].Interval <= 0 {
+			f.Monitors[i].Interval = 5 * time.Second
+		}
+	}
+	return f, nil
+}
+
+// TableInfos returns the tables of the case in the database.
+func (f *CaseFile) TableInfos(dbName string) ([]*data.TableInfo, error) {
+	tables := make([]*data.TableInfo, 0, len(f.Tables))
+	for _, t := range f.Tables {
+		cols := make([]data.ColumnDef, 0, len(t.Columns))
+		for _, col := range t.Columns {
+			cols = append(cols, data.ColumnDef{
+				Name:         col.Name,
+				Tp:           col.Type,
+				DefaultValue: col.Default,
+				MinValue:     col.Min,
+				MaxValue:     col.Max,
+				JSONDepth:    col.JSONDepth,
+				Distribution: col.Distribution,
+				NullRatio:    col.NullRatio,
+				Correlation:  col.Correlation,
+			})
+		}
+		indexes := make([]data.IndexInfo, 0, len(t.Indexes))
+		for _, idx := range t.Indexes {
+			info := data.IndexInfo{Columns: idx.Columns}
+			switch strings.ToLower(idx.Type) {
+			case "", "index":
+				info.Tp = data.NormalIndex
+			case "unique":
+				info.Tp = data.UniqueIndex
+			case "primary":
+				info.Tp = data.PrimaryKey
+			default:
+				return nil, fmt.Errorf("unknown index type %v of table %v, should be one of index, unique, primary", idx.Type, t.Name)
+			}
+			indexes = append(indexes, info)
+		}
+		tbl, err := data.NewTableInfo(dbName, t.Name, cols, indexes)
+		if err != nil {
+			return nil, fmt.Errorf("table %v: %v", t.Name, err)
+		}
+		tables = append(tables, tbl)
+	}
+	return tables, nil
+}
+
+func init() {
+	RegisterCaseCmd(newFileCase)
+}
+
+// fileCase is the Case of `case run`, which runs the case declared in the file.
+type fileCase struct {
+	BaseCase
+	cfg *config.Config
+	cmd *cobra.Command
+
+	path   string
+	mode   string
+	valMin int64
+	valMax int64
+
+	file     *CaseFile
+	tables   []*data.TableInfo
+	workload *Workload
+}
+
+func newFileCase(cfg *config.Config) Case {
+	return &fileCase{cfg: cfg}
+}
+
+func (c *fileCase) Cmd() *cobra.Command {
+	c.cmd = &cobra.Command{
+		Use:          "run",
+		Short:        "run the case declared in a YAML or TOML file",
+		Long:         `run the case whose schema, data, workload, monitoring queries and assertions are declared in the file`,
+		SilenceUsage: true,
+	}
+	c.cmd.Flags().StringVarP(&c.path, "file", "", "", "case file, YAML or TOML (.toml)")
+	c.cmd.Flags().StringVarP(&c.mode, "mode", "", ModeText, "how to send the statements: text, prepare or prepare-once")
+	c.cmd.Flags().Int64VarP(&c.valMin, "valmin", "", 0, randValueStr+"/"+seqValueStr+" min val")
+	c.cmd.Flags().Int64VarP(&c.valMax, "valmax", "", 0, randValueStr+"/"+seqValueStr+" max val")
+	return c.cmd
+}
+
+// Setup loads the case file, the database, concurrency and duration of the
+// file are used unless the flags are specified in the command line.
+func (c *fileCase) Setup(ctx context.Context, env *CaseEnv) error {
+	if c.path == "" {
+		return fmt.Errorf("need specify `file` parameter")
+	}
+	if c.mode != ModeText && c.mode != ModePrepare && c.mode != ModePrepareOnce {
+		return fmt.Errorf("unknown mode: %v", c.mode)
+	}
+	f, err := LoadCaseFile(c.path)
+	if err != nil {
+		return err
+	}
+	c.file = f
+	if f.Database != "" && !c.cmd.Flags().Changed("db") {
+		c.cfg.DBName = f.Database
+		c.cfg.Params["db"] = f.Database
+	}
+	if f.Concurrency > 0 && !c.cmd.Flags().Changed("concurrency") {
+		c.cfg.Concurrency = f.Concurrency
+		c.cfg.Params["concurrency"] = strconv.Itoa(f.Concurrency)
+	}
+	if f.Duration > 0 && !c.cmd.Flags().Changed("duration") {
+		c.cfg.Duration = f.Duration
+		c.cfg.Params["duration"] = f.Duration.String()
+	}
+	c.workload = &Workload{Statements: f.Statements, Mode: c.mode, Seed: c.cfg.Seed}
+	if err = c.workload.init(c.valMin, c.valMax); err != nil {
+		return fmt.Errorf("case %v: %v", f.Name, err)
+	}
+	c.tables, err = f.TableInfos(c.cfg.DBName)
+	if err != nil {
+		return err
+	}
+	c.cfg.Asserts = append(c.cfg.Asserts, f.Assert...)
+	for class, policy := range f.ErrorPolicy {
+		env.Runner.DefaultErrorPolicy(class, policy)
+	}
+	fmt.Printf("case: %v\nconcurrency: %v\n", f.Name, c.cfg.Concurrency)
+	return nil
+}
+
+func (c *fileCase) Load(ctx context.Context, env *CaseEnv) error {
+	for i, t := range c.tables {
+		load := data.NewLoadDataSuit(c.cfg)
+		if err := load.Prepare(ctx, t, c.file.Tables[i].Rows, 0); err != nil {
+			return fmt.Errorf("load table %v error: %v", t.TableName, err)
+		}
+	}
+	return env.Exec(ctx, c.file.Setup...)
+}
+
+func (c *fileCase) Workers(env *CaseEnv, id int, conn *sql.Conn) (Worker, error) {
+	return c.workload.NewWorker(id, conn), nil
+}
+
+// Report prints the results of the monitoring queries every their interval.
+func (c *fileCase) Report(ctx context.Context, env *CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(c.file.Monitors))
+	for _, m := range c.file.Monitors {
+		wg.Add(1)
+		go func(m CaseQuery) {
+			defer wg.Done()
+			for util.Sleep(ctx, m.Interval) {
+				fmt.Printf("---------------------------[ %v ]-------------------------\n", m.Name)
+				if err := util.QueryAndPrint(db, m.SQL); err != nil {
+					errCh <- fmt.Errorf("monitor %v error: %w", m.Name, err)
+					return
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables which override the flags,
+// such as TESTUTIL_HOST and TESTUTIL_MAX_QUERIES.
+const envPrefix = "TESTUTIL_"
+
+// configAliases are the config file keys which are different from the flag names.
+var configAliases = map[string]string{
+	"db-name": "db",
+}
+
+// applyConfig sets the flags which are not specified in the command line from
+// the environment variables, and then from the config file. The list values of
+// the environment variables are separated by newline, since the values such as
+// the statements may contain comma. The empty environment variables are ignored.
+func (app *App) applyConfig(cmd *cobra.Command) error {
+	path := app.configFile
+	if !cmd.Flags().Changed("config") {
+		if env := os.Getenv(envName("config")); env != "" {
+			path = env
+		}
+	}
+	fileValues := make(map[string]interface{})
+	if path != "" {
+		file, err := config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		fileValues, err = configValues(cmd, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" {
+			return
+		}
+		value, ok := fileValues[f.Name]
+		if env := os.Getenv(envName(f.Name)); env != "" {
+			value, ok = env, true
+			if _, isSlice := f.Value.(pflag.SliceValue); isSlice {
+				value = splitList(env)
+			}
+		}
+		if !ok {
+			return
+		}
+		if sv, isSlice := f.Value.(pflag.SliceValue); isSlice {
+			err = sv.Replace(configList(value))
+		} else {
+			err = f.Value.Set(configValue(value))
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid value %q of %v: %v", configValue(value), f.Name, err)
+		}
+	})
+	return err
+}
+
+// configValues returns the flag values of the command in the config file.
+func configValues(cmd *cobra.Command, file *config.File) (map[string]interface{}, error) {
+	var cmdPath []string
+	for c := cmd; c.HasParent(); c = c.Parent() {
+		cmdPath = append([]string{c.Name()}, cmdPath...)
+	}
+	values := make(map[string]interface{})
+	for _, item := range file.Items(cmdPath) {
+		name := item.Key
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+		if cmd.Flags().Lookup(name) == nil {
+			if _, isTable := item.Value.(map[string]interface{}); isTable || !item.Leaf {
+				// the table of the other commands, or the item for the other sub commands.
+				continue
+			}
+			if item.Table == "" {
+				return nil, fmt.Errorf("unknown item %v in config file %v", item.Key, file.Path())
+			}
+			return nil, fmt.Errorf("unknown item %v of [%v] in config file %v", item.Key, item.Table, file.Path())
+		}
+		values[name] = item.Value
+	}
+	return values, nil
+}
+
+// configValue converts the TOML value to the flag value, the arrays are joined
+// by comma and the tables are converted to `k1=v1,k2=v2`.
+func configValue(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, configValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(v))
+		for _, k := range keys {
+			items = append(items, k+"="+configValue(v[k]))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// configList converts the TOML value to the values of the list flag.
+func configList(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, configValue(item))
+		}
+		return items
+	default:
+		return []string{configValue(v)}
+	}
+}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// splitList splits the list value of the environment variable by newline, the empty items are skipped.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, "\n") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,37 +1,86 @@
 package cmd
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"github.com/crazycs520/testutil/config"
 	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type App struct {
-	cfg *config.Config
+	cfg        *config.Config
+	configFile string
+	// restoreGlobalVars restores the global variables set by `--global-var`.
+	restoreGlobalVars func(ctx context.Context) error
+	// varsSet is closed once restoreGlobalVars is set or the command exits before setting it.
+	varsSet     chan struct{}
+	varsSetOnce sync.Once
 }
 
 func NewApp() *App {
 	return &App{
-		cfg: &config.Config{},
+		cfg:     &config.Config{},
+		varsSet: make(chan struct{}),
 	}
 }
 
 func (app *App) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:          "testutil",
-		Short:        "testutil uses to do bench and case test",
-		RunE:         app.RunE,
-		SilenceUsage: true,
+		Use:               "testutil",
+		Short:             "testutil uses to do bench and case test",
+		RunE:              app.RunE,
+		PersistentPreRunE: app.PersistentPreRunE,
+		SilenceUsage:      true,
 	}
 
-	cmd.PersistentFlags().StringVarP(&app.cfg.Host, "host", "", "127.0.0.1", "database host ip")
+	cmd.PersistentFlags().StringVarP(&app.configFile, "config", "", "", "TOML config file, the command line flags and the TESTUTIL_* environment variables override it")
+	cmd.PersistentFlags().StringVarP(&app.cfg.Host, "host", "", "127.0.0.1", "database endpoints separated by comma, every endpoint is host[:port][=weight], such as 10.0.1.1,10.0.1.2:4001=2")
+	cmd.PersistentFlags().StringVarP(&app.cfg.HostFile, "host-file", "", "", "file of the database endpoints besides --host, one endpoint per line")
+	cmd.PersistentFlags().StringVarP(&app.cfg.LoadBalance, "load-balance", "", "round-robin", "load balance policy of the workers across the endpoints, one of round-robin, random, weight")
 	cmd.PersistentFlags().IntVarP(&app.cfg.Port, "port", "P", 4000, "database service port")
 	cmd.PersistentFlags().StringVarP(&app.cfg.User, "user", "u", "root", "database user name")
 	cmd.PersistentFlags().StringVarP(&app.cfg.Password, "password", "p", "", "database user password")
 	cmd.PersistentFlags().StringVarP(&app.cfg.DBName, "db", "d", "test", "database name")
+	cmd.PersistentFlags().StringVarP(&app.cfg.Socket, "socket", "S", "", "unix socket file of the database, it overrides --host")
+	cmd.PersistentFlags().StringVarP(&app.cfg.SSLMode, "ssl-mode", "", "", "TLS mode, one of disabled, preferred, required, verify-ca, verify-identity; default is verify-ca if --ssl-ca is specified, required if --ssl-cert is specified, otherwise disabled")
+	cmd.PersistentFlags().StringVarP(&app.cfg.SSLCA, "ssl-ca", "", "", "CA certificate file to verify the server certificate")
+	cmd.PersistentFlags().StringVarP(&app.cfg.SSLCert, "ssl-cert", "", "", "client certificate file")
+	cmd.PersistentFlags().StringVarP(&app.cfg.SSLKey, "ssl-key", "", "", "client private key file")
+	cmd.PersistentFlags().StringArrayVarP(&app.cfg.DSNParams, "dsn-param", "", nil, "extra DSN parameter of name=value, such as timeout=5s, readTimeout=30s, interpolateParams=true, maxAllowedPacket=0, can be specified multiple times")
 	cmd.PersistentFlags().IntVarP(&app.cfg.Concurrency, "concurrency", "f", 5, "app concurrency")
+	cmd.PersistentFlags().IntVarP(&app.cfg.MaxOpenConns, "max-open-conns", "", 0, "max open connections of the connection pool, 0 means no limit")
+	cmd.PersistentFlags().IntVarP(&app.cfg.MaxIdleConns, "max-idle-conns", "", 100, "max idle connections of the connection pool")
+	cmd.PersistentFlags().DurationVarP(&app.cfg.ConnMaxLifetime, "conn-max-lifetime", "", 0, "max lifetime of the connections, 0 means no limit")
+	cmd.PersistentFlags().StringArrayVarP(&app.cfg.InitSQL, "init-sql", "", nil, "statement executed on every new connection, such as set @@tidb_isolation_read_engines='tikv', can be specified multiple times")
+	cmd.PersistentFlags().StringArrayVarP(&app.cfg.SessionVars, "session-var", "", nil, "session variable set on every connection, such as tidb_txn_mode=pessimistic, can be specified multiple times")
+	cmd.PersistentFlags().StringArrayVarP(&app.cfg.GlobalVars, "global-var", "", nil, "global variable set before the run and restored on exit, such as tidb_enable_async_commit=1, can be specified multiple times")
+	cmd.PersistentFlags().DurationVarP(&app.cfg.Duration, "duration", "", 0, "run duration of bench and case, such as 10m, 0 means run until interrupted")
+	cmd.PersistentFlags().Int64VarP(&app.cfg.MaxQueries, "max-queries", "", 0, "max statements to execute of bench and case, 0 means no limit")
+	cmd.PersistentFlags().Float64VarP(&app.cfg.Rate, "rate", "", 0, "target total QPS of bench and case, the latency includes the queueing delay; 0 means the workers run back-to-back")
+	cmd.PersistentFlags().StringVarP(&app.cfg.Arrival, "arrival", "", ArrivalUniform, "arrival process of --rate: uniform or poisson")
+	cmd.PersistentFlags().StringVarP(&app.cfg.Ramp, "ramp", "", "", "increase the concurrency stepwise, such as 10:200:10 (start:end:step), it overrides --concurrency")
+	cmd.PersistentFlags().DurationVarP(&app.cfg.StepDuration, "step-duration", "", 30*time.Second, "run duration of every --ramp step")
+	cmd.PersistentFlags().BoolVarP(&app.cfg.FindMax, "find-max", "", false, "stop the --ramp run when the p99 exceeds --max-p99 or the throughput plateaus, and report the max step")
+	cmd.PersistentFlags().DurationVarP(&app.cfg.MaxP99, "max-p99", "", 0, "p99 latency threshold of --find-max, 0 means no threshold")
+	cmd.PersistentFlags().Float64VarP(&app.cfg.MinGain, "min-gain", "", 0.05, "--find-max stops when the throughput of a step grows less than the ratio")
+	cmd.PersistentFlags().StringToStringVarP(&app.cfg.ErrorPolicy, "error-policy", "", nil, "policy of the error classes: continue, retry or abort, such as write-conflict=continue,deadlock=retry,default=abort; the classes are "+strings.Join(util.ErrClasses, ", "))
+	cmd.PersistentFlags().IntVarP(&app.cfg.MaxRetries, "max-retries", "", 3, "max retry times of the errors whose policy is retry")
+	cmd.PersistentFlags().StringArrayVarP(&app.cfg.Asserts, "assert", "", nil, "assertion checked after the run, the command fails if it doesn't hold, such as p99<50ms, qps>1000, errors.write-conflict==0, get.p99<10ms or select count(*) from t = 100, can be specified multiple times")
+	cmd.PersistentFlags().Int64VarP(&app.cfg.Seed, "seed", "", 0, "seed of the generated data and statements, the same seed regenerates the same data and statement sequence of every worker; 0 means a random seed, which is printed")
+	cmd.PersistentFlags().StringVarP(&app.cfg.LoadMode, "load-mode", "", "batch", "how the generated rows are loaded: insert (a row per statement), batch (multi-row insert) or load-data (LOAD DATA LOCAL INFILE)")
+	cmd.PersistentFlags().IntVarP(&app.cfg.LoadBatch, "load-batch", "", 0, "rows of a transaction of --load-mode=insert, or of a statement of batch and load-data; 0 means 100 for insert and batch, 10000 for load-data")
+	cmd.PersistentFlags().StringVarP(&app.cfg.OutputFormat, "output-format", "", "text", "run result format: text, json or csv")
+	cmd.PersistentFlags().StringVarP(&app.cfg.OutputFile, "output-file", "", "", "write the run result to the file instead of stdout")
 
 	bench := BenchSQL{App: app}
 	cmd.AddCommand(bench.Cmd())
@@ -41,11 +90,72 @@ func (app *App) Cmd() *cobra.Command {
 	return cmd
 }
 
+// Execute executes the command, and restores the global variables set by `--global-var` before it returns.
+func (app *App) Execute() error {
+	// the handler is installed before the global variables are set, so they
+	// are restored on the signals out of the run, such as during the setup.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go app.handleSignal(sigCh)
+
+	err := app.Cmd().Execute()
+	app.varsSetOnce.Do(func() { close(app.varsSet) })
+	if app.restoreGlobalVars != nil {
+		if restoreErr := app.restoreGlobalVars(context.Background()); restoreErr != nil && err == nil {
+			err = restoreErr
+		}
+	}
+	return err
+}
+
+// handleSignal restores the global variables and exits on the signals which
+// are not handled by a runner. The restore is abandoned after forceExitTimeout.
+func (app *App) handleSignal(sigCh <-chan os.Signal) {
+	for sig := range sigCh {
+		if atomic.LoadInt32(&activeRunners) > 0 {
+			// the runner stops the run on the signal.
+			continue
+		}
+		fmt.Printf("received signal %v, restoring the global variables before exit...\n", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), forceExitTimeout)
+		select {
+		case <-app.varsSet:
+			if app.restoreGlobalVars != nil {
+				app.restoreGlobalVars(ctx)
+			}
+		case <-ctx.Done():
+		}
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func (app *App) PersistentPreRunE(cmd *cobra.Command, args []string) error {
+	if err := app.applyConfig(cmd); err != nil {
+		return err
+	}
+	if app.cfg.Seed == 0 {
+		app.cfg.Seed = time.Now().UnixNano()
+		app.cfg.RandomSeed = true
+	}
+	app.cfg.Command = cmd.CommandPath()
+	app.cfg.Params = make(map[string]string)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "password" || f.Name == "help" || f.Name == "config" {
+			return
+		}
+		app.cfg.Params[f.Name] = f.Value.String()
+	})
+	app.cfg.Params["seed"] = strconv.FormatInt(app.cfg.Seed, 10)
+	var err error
+	app.restoreGlobalVars, err = util.SetGlobalVars(app.cfg)
+	beforeForceExit = app.restoreGlobalVars
+	app.varsSetOnce.Do(func() { close(app.varsSet) })
+	return err
+}
+
 func (app *App) RunE(cmd *cobra.Command, args []string) error {
 	fmt.Printf("%v\n", app.cfg.String())
 	return cmd.Help()
 }
-
-func (app *App) GetSQLCli() *sql.DB {
-	return util.GetSQLCli(app.cfg)
-}
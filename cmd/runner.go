@@ -0,0 +1,655 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/stats"
+	"github.com/crazycs520/testutil/util"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Worker executes one operation of the workload every time Exec is called.
+type Worker interface {
+	Exec(ctx context.Context) error
+	Close() error
+}
+
+// WorkerFunc adapts a function to a Worker which has nothing to close.
+type WorkerFunc func(ctx context.Context) error
+
+func (f WorkerFunc) Exec(ctx context.Context) error {
+	return f(ctx)
+}
+
+func (f WorkerFunc) Close() error {
+	return nil
+}
+
+type connWorker struct {
+	conn *sql.Conn
+	exec func(ctx context.Context, conn *sql.Conn) error
+}
+
+// NewConnWorker returns a Worker which executes exec with the pinned conn, and
+// returns conn to the pool when the worker stops.
+func NewConnWorker(conn *sql.Conn, exec func(ctx context.Context, conn *sql.Conn) error) Worker {
+	return &connWorker{conn: conn, exec: exec}
+}
+
+func (w *connWorker) Exec(ctx context.Context) error {
+	return w.exec(ctx, w.conn)
+}
+
+func (w *connWorker) Close() error {
+	return w.conn.Close()
+}
+
+func (w *connWorker) pinnedConn() *sql.Conn {
+	return w.conn
+}
+
+// connHolder is implemented by the Worker which pins a connection of Runner.Conn,
+// the runner records the stats of every endpoint by the connection.
+type connHolder interface {
+	pinnedConn() *sql.Conn
+}
+
+// StatementNamer is implemented by the Worker which executes different statements,
+// the runner records the stats of every statement name besides the whole run.
+type StatementNamer interface {
+	// LastStatement returns the name of the statement executed by the last Exec,
+	// empty means the statement is not recorded separately.
+	LastStatement() string
+}
+
+// Monitor runs beside the workers until ctx is done, such as printing the slow query information.
+type Monitor func(ctx context.Context) error
+
+const (
+	// ArrivalUniform issues the statements of the open-loop run at a fixed interval.
+	ArrivalUniform = "uniform"
+	// ArrivalPoisson issues the statements of the open-loop run with exponentially distributed intervals.
+	ArrivalPoisson = "poisson"
+)
+
+// Runner drives the workers of a bench or case run. It stops the run when
+// `--duration` elapsed, `--max-queries` statements were issued, a worker
+// meets an error, or SIGINT/SIGTERM is received, and prints the final summary.
+//
+// With `--rate`, the run is open-loop: the statements are scheduled at the
+// target rate regardless of how fast the workers are, and the latency is
+// measured from the scheduled time, so the queueing delay is included when
+// the workers fall behind (coordinated omission corrected). The service
+// time from the statement was actually sent is reported too.
+//
+// The errors of the workers are classified by util.ClassifyError and counted
+// in the reports, the `--error-policy` of the class decides whether the run
+// continues, retries the operation or aborts.
+//
+// With `--ramp`, the workers are added stepwise and the summary of every step
+// is reported, `--find-max` stops the ramp once the workload is saturated.
+type Runner struct {
+	cfg      *config.Config
+	rec      *stats.Recorder
+	interval time.Duration
+	// step is the *stats.Recorder of the current ramp step.
+	step atomic.Value
+	// defaultPolicies are the error policies used unless `--error-policy` specifies the class.
+	defaultPolicies map[string]string
+	policy          *util.ErrorPolicy
+	// conns is the connection manager of the workers, it is created by the first Conn.
+	conns *util.ConnManager
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	sigCh   chan os.Signal
+	stopped int32
+
+	issued int64
+	mu     sync.Mutex
+	err    error
+}
+
+func NewRunner(cfg *config.Config) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Runner{
+		cfg:      cfg,
+		interval: time.Second,
+		ctx:      ctx,
+		cancel:   cancel,
+		sigCh:    make(chan os.Signal, 2),
+	}
+	signal.Notify(r.sigCh, syscall.SIGINT, syscall.SIGTERM)
+	atomic.AddInt32(&activeRunners, 1)
+	go r.handleSignal()
+	return r
+}
+
+// activeRunners is the number of the runners handling the signals, the signals
+// out of the runners are handled by the root command.
+var activeRunners int32
+
+// beforeForceExit restores the global variables set by `--global-var` before the
+// program exits on the second signal, it is set by the root command.
+var beforeForceExit func(ctx context.Context) error
+
+// forceExitTimeout is the timeout to restore the global variables before the forced exit.
+const forceExitTimeout = 5 * time.Second
+
+func (r *Runner) handleSignal() {
+	sig, ok := <-r.sigCh
+	if !ok {
+		return
+	}
+	fmt.Printf("received signal %v, stopping... (send again to exit immediately)\n", sig)
+	r.cancel()
+	if _, ok = <-r.sigCh; ok {
+		if beforeForceExit != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), forceExitTimeout)
+			beforeForceExit(ctx)
+			cancel()
+		}
+		os.Exit(1)
+	}
+}
+
+// DefaultErrorPolicy sets the policy of the error class unless `--error-policy`
+// specifies it, the class `default` is the policy of all the unspecified classes.
+func (r *Runner) DefaultErrorPolicy(class, policy string) {
+	if r.defaultPolicies == nil {
+		r.defaultPolicies = make(map[string]string)
+	}
+	r.defaultPolicies[class] = policy
+}
+
+// Conn returns a dedicated connection of the endpoint chosen by `--load-balance`
+// for a worker. The connections are closed when the run finishes.
+func (r *Runner) Conn() (*sql.Conn, error) {
+	r.mu.Lock()
+	if r.conns == nil {
+		conns, err := util.NewConnManager(r.cfg)
+		if err != nil {
+			r.mu.Unlock()
+			return nil, err
+		}
+		r.conns = conns
+	}
+	conns := r.conns
+	r.mu.Unlock()
+	return conns.Conn(r.ctx)
+}
+
+// endpoint returns the endpoint name of the worker, it is empty if there is only one endpoint.
+func (r *Runner) endpoint(w Worker) string {
+	holder, ok := w.(connHolder)
+	if !ok {
+		return ""
+	}
+	r.mu.Lock()
+	conns := r.conns
+	r.mu.Unlock()
+	if conns == nil || len(conns.Endpoints()) < 2 {
+		return ""
+	}
+	return conns.Endpoint(holder.pinnedConn()).String()
+}
+
+// Context returns the context of the run, it is canceled once the run should stop.
+func (r *Runner) Context() context.Context {
+	return r.ctx
+}
+
+// Recorder returns the recorder of the run, it is reset when Run starts.
+func (r *Runner) Recorder() *stats.Recorder {
+	return r.rec
+}
+
+// Run creates `concurrency` workers by newWorker, and runs them with the monitors
+// until the run is stopped. It returns the first error met by the workers or monitors.
+func (r *Runner) Run(newWorker func(id int) (Worker, error), monitors ...Monitor) error {
+	defer r.stop()
+	if r.cfg.Rate < 0 {
+		return fmt.Errorf("rate should not be negative")
+	}
+	if r.cfg.Rate > 0 && r.cfg.Arrival != ArrivalUniform && r.cfg.Arrival != ArrivalPoisson {
+		return fmt.Errorf("unknown arrival: %v, should be one of %v, %v", r.cfg.Arrival, ArrivalUniform, ArrivalPoisson)
+	}
+	ramp, err := parseRamp(r.cfg.Ramp)
+	if err != nil {
+		return err
+	}
+	policies := make(map[string]string, len(r.defaultPolicies)+len(r.cfg.ErrorPolicy))
+	for class, policy := range r.defaultPolicies {
+		policies[class] = policy
+	}
+	for class, policy := range r.cfg.ErrorPolicy {
+		policies[class] = policy
+	}
+	r.policy, err = util.NewErrorPolicy(policies, util.ErrPolicyAbort)
+	if err != nil {
+		return err
+	}
+	asserts := make([]*assertion, 0, len(r.cfg.Asserts))
+	for _, expr := range r.cfg.Asserts {
+		a, err := parseAssertion(expr)
+		if err != nil {
+			return err
+		}
+		asserts = append(asserts, a)
+	}
+	concurrency, maxConcurrency := r.cfg.Concurrency, r.cfg.Concurrency
+	if ramp != nil {
+		if r.cfg.StepDuration <= 0 {
+			return fmt.Errorf("step-duration should be positive")
+		}
+		concurrency, maxConcurrency = ramp.start, ramp.end
+	} else if r.cfg.FindMax {
+		return fmt.Errorf("find-max needs the ramp, such as --ramp 10:200:10")
+	}
+	sink, closeSink, err := r.openSink()
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+	ctx := r.ctx
+	if r.cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.Duration)
+		defer cancel()
+	}
+	workers := make([]Worker, 0, maxConcurrency)
+	defer func() {
+		for _, w := range workers {
+			w.Close()
+		}
+	}()
+	for len(workers) < concurrency {
+		w, err := newWorker(len(workers))
+		if err != nil {
+			return err
+		}
+		workers = append(workers, w)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.rec = stats.NewRecorder()
+	var arrivals <-chan time.Time
+	if r.cfg.Rate > 0 {
+		arrivals = r.schedule(ctx)
+	}
+	alive := 0
+	exited := make(chan struct{}, maxConcurrency)
+	startWorker := func(w Worker) {
+		alive++
+		go func() {
+			defer func() { exited <- struct{}{} }()
+			r.runWorker(ctx, w, arrivals)
+		}()
+	}
+	for _, w := range workers {
+		startWorker(w)
+	}
+	var monitorWg sync.WaitGroup
+	for _, m := range monitors {
+		monitorWg.Add(1)
+		go func(m Monitor) {
+			defer monitorWg.Done()
+			err := m(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.setErr(err)
+				cancel()
+			}
+		}(m)
+	}
+
+	var stepTimer *time.Timer
+	var stepCh <-chan time.Time
+	if ramp != nil {
+		r.step.Store(stats.NewRecorder())
+		stepTimer = time.NewTimer(r.cfg.StepDuration)
+		defer stepTimer.Stop()
+		stepCh = stepTimer.C
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			s := r.rec.TakeInterval()
+			setElapsed(&s, r.rec.Elapsed())
+			if err := sink.Interval(s); err != nil {
+				fmt.Printf("write interval result error: %v\n", err)
+			}
+		case <-stepCh:
+			step := stats.Step{Concurrency: len(workers), Summary: r.stepRecorder().Summary()}
+			if err := sink.Step(step); err != nil {
+				fmt.Printf("write step result error: %v\n", err)
+			}
+			next, ok := ramp.next(r.cfg, step)
+			if !ok {
+				running = false
+				break
+			}
+			for len(workers) < next {
+				w, err := newWorker(len(workers))
+				if err != nil {
+					r.setErr(err)
+					running = false
+					break
+				}
+				workers = append(workers, w)
+				startWorker(w)
+			}
+			r.step.Store(stats.NewRecorder())
+			stepTimer.Reset(r.cfg.StepDuration)
+		case <-exited:
+			alive--
+			running = alive > 0
+		case <-ctx.Done():
+			running = false
+		}
+	}
+	cancel()
+	for ; alive > 0; alive-- {
+		<-exited
+	}
+	monitorWg.Wait()
+	err = r.getErr()
+	result := stats.Result{
+		Command: r.cfg.Command,
+		Params:  r.cfg.Params,
+		Summary: r.rec.Summary(),
+		Err:     err,
+	}
+	if ramp != nil && r.cfg.FindMax {
+		result.MaxStep = ramp.max
+		if ramp.max == nil {
+			fmt.Println("find-max: no step meets the p99 threshold")
+		}
+	}
+	assertErr := r.checkAssertions(asserts, &result)
+	if sinkErr := sink.Final(result); sinkErr != nil && err == nil {
+		err = sinkErr
+	}
+	if err == nil {
+		err = assertErr
+	}
+	return err
+}
+
+// checkAssertions checks the assertions with the final summary, and returns
+// an *AssertionError if any of them failed.
+func (r *Runner) checkAssertions(asserts []*assertion, result *stats.Result) error {
+	if len(asserts) == 0 {
+		return nil
+	}
+	var db *sql.DB
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+	openDB := func() (*sql.DB, error) {
+		if db == nil {
+			var err error
+			if db, err = util.OpenDB(r.cfg, r.cfg.DBName); err != nil {
+				return nil, err
+			}
+		}
+		return db, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var failed []string
+	for _, a := range asserts {
+		res := a.check(ctx, result.Summary, openDB)
+		result.Assertions = append(result.Assertions, res)
+		if !res.Passed {
+			failed = append(failed, fmt.Sprintf("%v (actual: %v)", res.Expr, res.Actual))
+		}
+	}
+	if len(failed) > 0 {
+		return &AssertionError{Failed: failed}
+	}
+	return nil
+}
+
+func (r *Runner) stepRecorder() *stats.Recorder {
+	rec, _ := r.step.Load().(*stats.Recorder)
+	return rec
+}
+
+// ramp is the concurrency steps of the ramp run.
+type ramp struct {
+	start, end, step int
+	// max is the step with the max throughput in the find-max run.
+	max *stats.Step
+}
+
+// parseRamp parses the ramp of `start:end:step`, it returns nil if s is empty.
+func parseRamp(s string) (*ramp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid ramp: %v, should be start:end:step, such as 10:200:10", s)
+	}
+	var nums [3]int
+	for i, field := range fields {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid ramp: %v, start, end and step should be positive integers", s)
+		}
+		nums[i] = n
+	}
+	if nums[1] < nums[0] {
+		return nil, fmt.Errorf("invalid ramp: %v, end should not be less than start", s)
+	}
+	return &ramp{start: nums[0], end: nums[1], step: nums[2]}, nil
+}
+
+// next returns the concurrency of the next step, it returns false if the ramp run should stop.
+func (rp *ramp) next(cfg *config.Config, s stats.Step) (int, bool) {
+	if cfg.FindMax {
+		if cfg.MaxP99 > 0 && s.Summary.P99 > cfg.MaxP99 {
+			return 0, false
+		}
+		gain := rp.max == nil || s.Summary.QPS >= rp.max.Summary.QPS*(1+cfg.MinGain)
+		if rp.max == nil || s.Summary.QPS > rp.max.Summary.QPS {
+			rp.max = &s
+		}
+		if !gain {
+			return 0, false
+		}
+	}
+	if s.Concurrency >= rp.end {
+		return 0, false
+	}
+	next := s.Concurrency + rp.step
+	if next > rp.end {
+		next = rp.end
+	}
+	return next, true
+}
+
+// openSink opens the sinks of the run result. The text result is always printed
+// to stdout, unless the result in other format is written to stdout.
+func (r *Runner) openSink() (stats.Sink, func(), error) {
+	closeFn := func() {}
+	format := r.cfg.OutputFormat
+	if r.cfg.OutputFile == "" {
+		sink, err := stats.NewSink(format, os.Stdout)
+		return sink, closeFn, err
+	}
+	stdout, err := stats.NewSink(stats.FormatText, os.Stdout)
+	if err != nil {
+		return nil, closeFn, err
+	}
+	file, err := os.Create(r.cfg.OutputFile)
+	if err != nil {
+		return nil, closeFn, err
+	}
+	sink, err := stats.NewSink(format, file)
+	if err != nil {
+		file.Close()
+		return nil, closeFn, err
+	}
+	return stats.MultiSink{stdout, sink}, func() { file.Close() }, nil
+}
+
+// schedule sends the intended start time of every statement of the open-loop
+// run. The schedule doesn't slow down when the workers fall behind, the
+// statements just wait in the queue.
+func (r *Runner) schedule(ctx context.Context) <-chan time.Time {
+	ch := make(chan time.Time, r.cfg.Concurrency)
+	rnd := util.NewRand(r.cfg.Seed, -1)
+	go func() {
+		next := time.Now()
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		for {
+			if d := time.Until(next); d > 0 {
+				timer.Reset(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case ch <- next:
+			case <-ctx.Done():
+				return
+			}
+			interval := 1 / r.cfg.Rate
+			if r.cfg.Arrival == ArrivalPoisson {
+				interval = rnd.ExpFloat64() / r.cfg.Rate
+			}
+			next = next.Add(time.Duration(interval * float64(time.Second)))
+		}
+	}()
+	return ch
+}
+
+func (r *Runner) runWorker(ctx context.Context, w Worker, arrivals <-chan time.Time) {
+	endpoint := r.endpoint(w)
+	for ctx.Err() == nil {
+		if r.cfg.MaxQueries > 0 && atomic.AddInt64(&r.issued, 1) > r.cfg.MaxQueries {
+			// let the other workers finish their in-flight statements.
+			return
+		}
+		var intended time.Time
+		if arrivals != nil {
+			select {
+			case intended = <-arrivals:
+			case <-ctx.Done():
+				return
+			}
+		}
+		start := time.Now()
+		for retry := 0; ; retry++ {
+			err := w.Exec(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			recs := r.recorders(w, endpoint)
+			if err == nil {
+				end := time.Now()
+				for _, rec := range recs {
+					if arrivals != nil {
+						rec.RecordLatency(end.Sub(intended), end.Sub(start))
+					} else {
+						rec.Record(end.Sub(start))
+					}
+				}
+				break
+			}
+			class := util.ClassifyError(err)
+			for _, rec := range recs {
+				rec.RecordError(class)
+			}
+			policy := r.policy.Policy(class)
+			if policy == util.ErrPolicyAbort {
+				r.setErr(err)
+				r.cancel()
+				return
+			}
+			if policy == util.ErrPolicyContinue || retry >= r.cfg.MaxRetries {
+				break
+			}
+		}
+	}
+}
+
+// recorders returns the recorders of the operation just executed by w,
+// including the breakdowns of the statement and the endpoint.
+func (r *Runner) recorders(w Worker, endpoint string) []*stats.Recorder {
+	var subs []string
+	if namer, ok := w.(StatementNamer); ok && namer.LastStatement() != "" {
+		subs = append(subs, namer.LastStatement())
+	}
+	if endpoint != "" {
+		subs = append(subs, endpoint)
+	}
+	recs := []*stats.Recorder{r.rec}
+	if step := r.stepRecorder(); step != nil {
+		recs = append(recs, step)
+	}
+	for _, rec := range recs[:len(recs):len(recs)] {
+		for _, sub := range subs {
+			recs = append(recs, rec.Sub(sub))
+		}
+	}
+	return recs
+}
+
+// setElapsed sets the elapsed time of the summary and its breakdowns to the run elapsed time.
+func setElapsed(s *stats.Summary, elapsed time.Duration) {
+	s.Elapsed = elapsed
+	if s.Service != nil {
+		s.Service.Elapsed = elapsed
+	}
+	for i := range s.Subs {
+		setElapsed(&s.Subs[i], elapsed)
+	}
+}
+
+func (r *Runner) setErr(err error) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+}
+
+func (r *Runner) getErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Runner) stop() {
+	if !atomic.CompareAndSwapInt32(&r.stopped, 0, 1) {
+		return
+	}
+	signal.Stop(r.sigCh)
+	close(r.sigCh)
+	atomic.AddInt32(&activeRunners, -1)
+	r.cancel()
+	r.mu.Lock()
+	if r.conns != nil {
+		r.conns.Close()
+	}
+	r.mu.Unlock()
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/stats"
+	"github.com/crazycs520/testutil/util"
+	"github.com/go-sql-driver/mysql"
+)
+
+// sleepWorker returns the workers which sleep d in every Exec.
+func sleepWorker(d time.Duration) func(id int) (Worker, error) {
+	return func(id int) (Worker, error) {
+		return WorkerFunc(func(ctx context.Context) error {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+			}
+			return nil
+		}), nil
+	}
+}
+
+func runSummary(t *testing.T, cfg *config.Config, newWorker func(id int) (Worker, error)) stats.Summary {
+	t.Helper()
+	r := NewRunner(cfg)
+	if err := r.Run(newWorker); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	return r.Recorder().Summary()
+}
+
+func TestRunnerOpenLoopRate(t *testing.T) {
+	// the fast worker follows the rate.
+	s := runSummary(t, &config.Config{Concurrency: 2, Rate: 100, Arrival: ArrivalUniform, Duration: 500 * time.Millisecond}, sleepWorker(0))
+	if s.Count < 35 || s.Count > 55 {
+		t.Errorf("expect about 50 statements at 100/s in 500ms, got %v", s.Count)
+	}
+	if s.Service == nil {
+		t.Fatalf("the open-loop run should report the service time")
+	}
+}
+
+func TestRunnerOpenLoopQueueing(t *testing.T) {
+	// the worker serves 50/s, so the statements scheduled at 100/s wait in the
+	// queue, and the waiting time is counted in the latency.
+	s := runSummary(t, &config.Config{Concurrency: 1, Rate: 100, Arrival: ArrivalPoisson, Duration: 500 * time.Millisecond}, sleepWorker(20*time.Millisecond))
+	if s.Service == nil || s.Service.Avg < 20*time.Millisecond {
+		t.Fatalf("unexpected service time %+v", s.Service)
+	}
+	if s.Max < s.Service.Max+100*time.Millisecond {
+		t.Errorf("the latency %v should include the queueing delay, the service time is %v", s.Max, s.Service.Max)
+	}
+}
+
+// runSteps runs the ramp with the json output, and returns the concurrency of
+// every step and of the max step.
+func runSteps(t *testing.T, cfg *config.Config, newWorker func(id int) (Worker, error)) ([]int, int) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ramp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg.OutputFormat = stats.FormatJSON
+	cfg.OutputFile = filepath.Join(dir, "result.json")
+	if err := NewRunner(cfg).Run(newWorker); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	file, err := os.Open(cfg.OutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var steps []int
+	max := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec struct {
+			Type        string `json:"type"`
+			Concurrency int    `json:"concurrency"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid json record %s: %v", scanner.Text(), err)
+		}
+		switch rec.Type {
+		case "step":
+			steps = append(steps, rec.Concurrency)
+		case "max":
+			max = rec.Concurrency
+		}
+	}
+	return steps, max
+}
+
+func TestRunnerRampSteps(t *testing.T) {
+	var created int32
+	newWorker := func(id int) (Worker, error) {
+		if int(atomic.AddInt32(&created, 1)) != id+1 {
+			t.Errorf("worker %v is created out of order", id)
+		}
+		return sleepWorker(time.Millisecond)(id)
+	}
+	// the last step is clamped to the end of the ramp.
+	steps, max := runSteps(t, &config.Config{Ramp: "1:6:2", StepDuration: 50 * time.Millisecond}, newWorker)
+	if len(steps) != 4 || steps[0] != 1 || steps[1] != 3 || steps[2] != 5 || steps[3] != 6 {
+		t.Errorf("expect the steps 1, 3, 5, 6, got %v", steps)
+	}
+	if created != 6 || max != 0 {
+		t.Errorf("expect 6 workers and no max step without find-max, got %v, %v", created, max)
+	}
+}
+
+func TestRunnerFindMaxPlateau(t *testing.T) {
+	// the workers share 2 slots, so the throughput stops growing after 2 workers.
+	slots := make(chan struct{}, 2)
+	newWorker := func(id int) (Worker, error) {
+		return WorkerFunc(func(ctx context.Context) error {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			time.Sleep(2 * time.Millisecond)
+			<-slots
+			return nil
+		}), nil
+	}
+	steps, max := runSteps(t, &config.Config{Ramp: "1:10:1", StepDuration: 200 * time.Millisecond, FindMax: true, MinGain: 0.3}, newWorker)
+	if len(steps) != 3 || steps[2] != 3 {
+		t.Errorf("expect the run stops at the step of 3 workers, got %v", steps)
+	}
+	if max != 2 && max != 3 {
+		t.Errorf("expect the max step of 2 or 3 workers, got %v", max)
+	}
+}
+
+func TestRunnerFindMaxP99(t *testing.T) {
+	// the throughput grows until the latency jumps at 3 workers, which exceeds the max p99.
+	var workers int32
+	newWorker := func(id int) (Worker, error) {
+		atomic.AddInt32(&workers, 1)
+		return WorkerFunc(func(ctx context.Context) error {
+			if atomic.LoadInt32(&workers) < 3 {
+				time.Sleep(2 * time.Millisecond)
+			} else {
+				time.Sleep(150 * time.Millisecond)
+			}
+			return nil
+		}), nil
+	}
+	// p99 is the max of the few statements in a step, the threshold is far above the scheduling delays.
+	steps, max := runSteps(t, &config.Config{Ramp: "1:10:1", StepDuration: 300 * time.Millisecond, FindMax: true, MaxP99: 100 * time.Millisecond}, newWorker)
+	if len(steps) != 3 || steps[2] != 3 {
+		t.Errorf("expect the run stops at the step of 3 workers, got %v", steps)
+	}
+	if max != 2 {
+		t.Errorf("expect the max step of 2 workers below the p99 threshold, got %v", max)
+	}
+}
+
+func TestRunnerRampErrors(t *testing.T) {
+	for _, cfg := range []*config.Config{
+		{Ramp: "10:1:1", StepDuration: time.Second},
+		{Ramp: "1:10", StepDuration: time.Second},
+		{Ramp: "1:10:1"},
+		{Concurrency: 1, FindMax: true},
+	} {
+		if err := NewRunner(cfg).Run(sleepWorker(0)); err == nil {
+			t.Errorf("ramp %q, step duration %v, find-max %v: expect error", cfg.Ramp, cfg.StepDuration, cfg.FindMax)
+		}
+	}
+}
+
+// scriptedWorker returns the error of fail(n) on the n-th Exec, n starts from 1.
+type scriptedWorker struct {
+	calls int
+	fail  func(n int) error
+}
+
+func (w *scriptedWorker) Exec(ctx context.Context) error {
+	w.calls++
+	return w.fail(w.calls)
+}
+
+func (w *scriptedWorker) Close() error {
+	return nil
+}
+
+func TestRunnerErrorPolicies(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	writeConflict := &mysql.MySQLError{Number: 9007, Message: "Write conflict"}
+	unknown := &mysql.MySQLError{Number: 1105, Message: "unknown error"}
+
+	t.Run("retry until success", func(t *testing.T) {
+		// every operation fails twice and succeeds on the second retry.
+		w := &scriptedWorker{fail: func(n int) error {
+			if n%3 != 0 {
+				return deadlock
+			}
+			return nil
+		}}
+		cfg := &config.Config{Concurrency: 1, MaxQueries: 10, MaxRetries: 2, ErrorPolicy: map[string]string{util.ErrClassDeadlock: util.ErrPolicyRetry}}
+		s := runSummary(t, cfg, func(int) (Worker, error) { return w, nil })
+		if w.calls != 30 || s.Count != 10 || s.Errors[util.ErrClassDeadlock] != 20 {
+			t.Errorf("calls %v, count %v, errors %v", w.calls, s.Count, s.Errors)
+		}
+	})
+	t.Run("retry exhausted", func(t *testing.T) {
+		w := &scriptedWorker{fail: func(int) error { return deadlock }}
+		cfg := &config.Config{Concurrency: 1, MaxQueries: 5, MaxRetries: 2, ErrorPolicy: map[string]string{util.ErrClassDeadlock: util.ErrPolicyRetry}}
+		s := runSummary(t, cfg, func(int) (Worker, error) { return w, nil })
+		if w.calls != 15 || s.Count != 0 || s.Errors[util.ErrClassDeadlock] != 15 {
+			t.Errorf("calls %v, count %v, errors %v", w.calls, s.Count, s.Errors)
+		}
+	})
+	t.Run("continue", func(t *testing.T) {
+		w := &scriptedWorker{fail: func(n int) error {
+			if n%2 == 0 {
+				return writeConflict
+			}
+			return nil
+		}}
+		cfg := &config.Config{Concurrency: 1, MaxQueries: 10, MaxRetries: 2, ErrorPolicy: map[string]string{util.ErrClassWriteConflict: util.ErrPolicyContinue}}
+		s := runSummary(t, cfg, func(int) (Worker, error) { return w, nil })
+		if w.calls != 10 || s.Count != 5 || s.Errors[util.ErrClassWriteConflict] != 5 {
+			t.Errorf("calls %v, count %v, errors %v", w.calls, s.Count, s.Errors)
+		}
+	})
+	t.Run("abort by default", func(t *testing.T) {
+		w := &scriptedWorker{fail: func(n int) error {
+			if n == 3 {
+				return fmt.Errorf("exec: select 1, err: %w", unknown)
+			}
+			return nil
+		}}
+		r := NewRunner(&config.Config{Concurrency: 1, MaxQueries: 10, ErrorPolicy: map[string]string{util.ErrClassDeadlock: util.ErrPolicyRetry}})
+		err := r.Run(func(int) (Worker, error) { return w, nil })
+		if !errors.Is(err, unknown) {
+			t.Fatalf("expect the run aborts with the unknown error, got %v", err)
+		}
+		if s := r.Recorder().Summary(); w.calls != 3 || s.Count != 2 || s.Errors[util.ErrClassUnknown] != 1 {
+			t.Errorf("calls %v, count %v, errors %v", w.calls, s.Count, s.Errors)
+		}
+	})
+	t.Run("invalid policy", func(t *testing.T) {
+		cfg := &config.Config{Concurrency: 1, ErrorPolicy: map[string]string{"timeout": util.ErrPolicyRetry}}
+		if err := NewRunner(cfg).Run(sleepWorker(0)); err == nil {
+			t.Errorf("expect the unknown error class error")
+		}
+	})
+}
@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/data"
+	"github.com/crazycs520/testutil/util"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Workload is a weighted mix of statements, it is loaded from the file of `bench --workload`, such as:
+//
+//	statements:
+//	  - name: point-get
+//	    weight: 70
+//	    sql: select * from t where id = #rand-val
+//	    valmin: 0
+//	    valmax: 10000
+//	  - name: transfer
+//	    weight: 30
+//	    vars:
+//	      from: int(1, 1000)
+//	      to: int(1, 1000)
+//	    txn:
+//	      - update t set count = count - 1 where id = {{from}}
+//	      - update t set count = count + 1 where id = {{to}}
+//
+// The placeholders of the statements are described in data.Template.
+type Workload struct {
+	Statements []*WorkloadStmt `yaml:"statements" toml:"statements"`
+	// Mode is how the statements are sent, see ModeText, ModePrepare and ModePrepareOnce.
+	Mode string `yaml:"-" toml:"-"`
+	// Seed is the seed of the rand of the workers, see util.NewRand.
+	Seed int64 `yaml:"-" toml:"-"`
+
+	totalWeight int
+}
+
+const (
+	// ModeText sends the statements by the text protocol.
+	ModeText = "text"
+	// ModePrepare prepares the statement and executes it by the binary protocol every time.
+	ModePrepare = "prepare"
+	// ModePrepareOnce prepares the statement once for every worker, and then executes it repeatedly.
+	ModePrepareOnce = "prepare-once"
+)
+
+// WorkloadStmt is a statement of the workload. If Txn is specified, the
+// statements in Txn are executed in one transaction instead of SQL. Vars are
+// the named placeholders shared by the statements. `#rand-val` and `#seq-val`
+// are the placeholders of int(valmin, valmax) and gseq(1), and every `?` marker
+// is an independent int(valmin, valmax) placeholder.
+type WorkloadStmt struct {
+	Name   string            `yaml:"name" toml:"name"`
+	Weight int               `yaml:"weight" toml:"weight"`
+	SQL    string            `yaml:"sql" toml:"sql"`
+	Txn    []string          `yaml:"txn" toml:"txn"`
+	Vars   map[string]string `yaml:"vars" toml:"vars"`
+	ValMin *int64            `yaml:"valmin" toml:"valmin"`
+	ValMax *int64            `yaml:"valmax" toml:"valmax"`
+
+	tmpl *data.Template
+}
+
+// LoadWorkload loads the workload file, valMin and valMax are used for the
+// statements which don't specify their own placeholder range.
+func LoadWorkload(path string, valMin, valMax int64) (*Workload, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workload{}
+	err = yaml.UnmarshalStrict(content, w)
+	if err != nil {
+		return nil, fmt.Errorf("parse workload file %v error: %v", path, err)
+	}
+	return w, w.init(valMin, valMax)
+}
+
+// NewSingleWorkload returns the workload which only has the query.
+func NewSingleWorkload(query string, valMin, valMax int64) (*Workload, error) {
+	w := &Workload{Statements: []*WorkloadStmt{{Name: "sql", SQL: query}}}
+	return w, w.init(valMin, valMax)
+}
+
+func (w *Workload) init(valMin, valMax int64) error {
+	if len(w.Statements) == 0 {
+		return fmt.Errorf("workload doesn't have any statement")
+	}
+	if w.Mode == "" {
+		w.Mode = ModeText
+	}
+	names := make(map[string]struct{}, len(w.Statements))
+	for i, s := range w.Statements {
+		if s.Name == "" {
+			s.Name = "stmt-" + strconv.Itoa(i)
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("duplicate workload statement name: %v", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if (s.SQL == "") == (len(s.Txn) == 0) {
+			return fmt.Errorf("workload statement %v should specify one of `sql` and `txn`", s.Name)
+		}
+		if s.Weight < 0 {
+			return fmt.Errorf("workload statement %v weight should not be negative", s.Name)
+		}
+		if s.Weight == 0 {
+			s.Weight = 1
+		}
+		if s.ValMin == nil {
+			s.ValMin = &valMin
+		}
+		if s.ValMax == nil {
+			s.ValMax = &valMax
+		}
+		if err := s.parseTemplate(); err != nil {
+			return fmt.Errorf("workload statement %v: %v", s.Name, err)
+		}
+		w.totalWeight += s.Weight
+	}
+	return nil
+}
+
+func (w *Workload) pick(rnd *rand.Rand) *WorkloadStmt {
+	if len(w.Statements) == 1 {
+		return w.Statements[0]
+	}
+	n := rnd.Intn(w.totalWeight)
+	for _, s := range w.Statements {
+		if n < s.Weight {
+			return s
+		}
+		n -= s.Weight
+	}
+	return w.Statements[len(w.Statements)-1]
+}
+
+// NewWorker returns the id-th worker which executes the statements of the workload with the pinned conn.
+func (w *Workload) NewWorker(id int, conn *sql.Conn) Worker {
+	rnd := util.NewRand(w.Seed, int64(id))
+	worker := &workloadWorker{
+		workload:  w,
+		rnd:       rnd,
+		conn:      conn,
+		renderers: make(map[*WorkloadStmt]*data.Renderer, len(w.Statements)),
+		prepared:  make(map[preparedKey]*sql.Stmt),
+	}
+	for _, s := range w.Statements {
+		worker.renderers[s] = s.tmpl.NewRenderer(rnd)
+	}
+	return worker
+}
+
+type workloadWorker struct {
+	workload  *Workload
+	conn      *sql.Conn
+	renderers map[*WorkloadStmt]*data.Renderer
+	rnd       *rand.Rand
+	// prepared is the prepared statements in ModePrepareOnce.
+	prepared map[preparedKey]*sql.Stmt
+	// last is the name of the last statement, it is empty if the workload only has one statement.
+	last string
+}
+
+type preparedKey struct {
+	stmt *WorkloadStmt
+	idx  int
+}
+
+func (w *workloadWorker) Exec(ctx context.Context) error {
+	stmt := w.workload.pick(w.rnd)
+	if len(w.workload.Statements) > 1 {
+		w.last = stmt.Name
+	}
+	return w.execStmt(ctx, w.conn, stmt)
+}
+
+func (w *workloadWorker) pinnedConn() *sql.Conn {
+	return w.conn
+}
+
+func (w *workloadWorker) LastStatement() string {
+	return w.last
+}
+
+func (w *workloadWorker) Close() error {
+	for _, stmt := range w.prepared {
+		stmt.Close()
+	}
+	return w.conn.Close()
+}
+
+// execStmt executes the statement s. The transaction is started by the
+// statement since the connection is pinned, so that the statements prepared
+// on the connection can be used in the transaction.
+func (w *workloadWorker) execStmt(ctx context.Context, conn *sql.Conn, s *WorkloadStmt) error {
+	r := w.renderers[s]
+	r.Next()
+	if len(s.Txn) == 0 {
+		return w.execSQL(ctx, conn, s, 0, r)
+	}
+	if _, err := conn.ExecContext(ctx, "begin"); err != nil {
+		return err
+	}
+	for i := range s.Txn {
+		if err := w.execSQL(ctx, conn, s, i, r); err != nil {
+			conn.ExecContext(context.Background(), "rollback")
+			return err
+		}
+	}
+	_, err := conn.ExecContext(ctx, "commit")
+	return err
+}
+
+// execSQL executes the i-th sql of s.
+func (w *workloadWorker) execSQL(ctx context.Context, conn *sql.Conn, s *WorkloadStmt, i int, r *data.Renderer) error {
+	switch w.workload.Mode {
+	case ModePrepare:
+		query := s.tmpl.PreparedSQL(i)
+		stmt, err := conn.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("prepare: %v, err: %w", query, err)
+		}
+		defer stmt.Close()
+		return execPrepared(ctx, stmt, query, r.Args(i))
+	case ModePrepareOnce:
+		key := preparedKey{stmt: s, idx: i}
+		query := s.tmpl.PreparedSQL(i)
+		stmt, ok := w.prepared[key]
+		if !ok {
+			var err error
+			stmt, err = conn.PrepareContext(ctx, query)
+			if err != nil {
+				return fmt.Errorf("prepare: %v, err: %w", query, err)
+			}
+			w.prepared[key] = stmt
+		}
+		return execPrepared(ctx, stmt, query, r.Args(i))
+	default:
+		return execSQL(ctx, conn, r.SQL(i))
+	}
+}
+
+func isQuery(sqlStr string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(sqlStr)), "select")
+}
+
+func execSQL(ctx context.Context, conn *sql.Conn, sqlStr string) error {
+	if !isQuery(sqlStr) {
+		_, err := conn.ExecContext(ctx, sqlStr)
+		if err != nil {
+			return fmt.Errorf("exec: %v, err: %w", sqlStr, err)
+		}
+		return nil
+	}
+	rows, err := conn.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return fmt.Errorf("exec: %v, err: %w", sqlStr, err)
+	}
+	return drainRows(rows)
+}
+
+func execPrepared(ctx context.Context, stmt *sql.Stmt, query string, args []interface{}) error {
+	if !isQuery(query) {
+		_, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return fmt.Errorf("exec: %v, args: %v, err: %w", query, args, err)
+		}
+		return nil
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("exec: %v, args: %v, err: %w", query, args, err)
+	}
+	return drainRows(rows)
+}
+
+func drainRows(rows *sql.Rows) error {
+	for rows.Next() {
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+func (s *WorkloadStmt) parseTemplate() error {
+	sqls := s.Txn
+	if len(sqls) == 0 {
+		sqls = []string{s.SQL}
+	}
+	vars := make(map[string]string, len(s.Vars)+2)
+	for name, spec := range s.Vars {
+		vars[name] = spec
+	}
+	converted := make([]string, 0, len(sqls))
+	for _, query := range sqls {
+		if strings.Contains(query, randValueStr) {
+			vars[randValueStr[1:]] = fmt.Sprintf("int(%v, %v)", *s.ValMin, *s.ValMax)
+			query = strings.Replace(query, randValueStr, "{{"+randValueStr[1:]+"}}", -1)
+		}
+		if strings.Contains(query, seqValueStr) {
+			vars[seqValueStr[1:]] = "gseq(1)"
+			query = strings.Replace(query, seqValueStr, "{{"+seqValueStr[1:]+"}}", -1)
+		}
+		query = replaceParamMarkers(query, fmt.Sprintf("{{int(%v, %v)}}", *s.ValMin, *s.ValMax))
+		converted = append(converted, query)
+	}
+	tmpl, err := data.ParseTemplate(vars, converted...)
+	if err != nil {
+		return err
+	}
+	s.tmpl = tmpl
+	return nil
+}
+
+// replaceParamMarkers replaces the `?` markers which are not quoted in the query.
+func replaceParamMarkers(query, repl string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(query) {
+				b.WriteByte(c)
+				i++
+				c = query[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			b.WriteString(repl)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
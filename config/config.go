@@ -1,6 +1,9 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // DBConfig is database configuration.
 type DBConfig struct {
@@ -9,14 +12,82 @@ type DBConfig struct {
 	User     string `toml:"user" json:"user"`
 	Password string `toml:"password" json:"-"` // omit it for privacy
 	DBName   string `toml:"db-name" json:"db-name"`
+	// HostFile is the file of the endpoints besides Host, see Endpoints.
+	HostFile string `toml:"host-file" json:"host-file"`
+	// LoadBalance is how the workers are distributed to the endpoints, such as round-robin, random and weight.
+	LoadBalance string `toml:"load-balance" json:"load-balance"`
+	// Socket is the unix socket file, it overrides the endpoints if it is set.
+	Socket string `toml:"socket" json:"socket"`
+	// SSLMode is one of disabled, preferred, required, verify-ca and verify-identity.
+	SSLMode string `toml:"ssl-mode" json:"ssl-mode"`
+	SSLCA   string `toml:"ssl-ca" json:"ssl-ca"`
+	SSLCert string `toml:"ssl-cert" json:"ssl-cert"`
+	SSLKey  string `toml:"ssl-key" json:"ssl-key"`
+	// DSNParams are the extra DSN parameters of `name=value`, such as readTimeout=10s.
+	DSNParams []string `toml:"dsn-param" json:"dsn-param"`
 }
 
 type Config struct {
 	DBConfig
 	Concurrency int
+
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime are the settings of the connection pool.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// InitSQL are the statements executed on every new connection, such as setting the session variables.
+	InitSQL []string
+	// SessionVars are the session variables of `name=value` set on every new connection.
+	SessionVars []string
+	// GlobalVars are the global variables of `name=value` set before the command runs, they are restored on exit.
+	GlobalVars []string
+	// Seed is the seed of the generated data and statements, the workers and the
+	// loaders derive their own rand from it. 0 means a random seed.
+	Seed int64
+	// RandomSeed is true if Seed is chosen randomly since `--seed` is not given.
+	RandomSeed bool
+	// LoadMode is how the generated rows are loaded, one of insert, batch and load-data.
+	LoadMode string
+	// LoadBatch is the rows of a transaction of insert, and of a statement of batch
+	// and load-data, 0 means the default of the load mode.
+	LoadBatch int
+
+	// Duration is the run duration of bench and case commands, 0 means run until interrupted.
+	Duration time.Duration
+	// MaxQueries is the max statements issued by bench and case commands, 0 means no limit.
+	MaxQueries int64
+	// Rate is the target total QPS of the open-loop run, 0 means the workers issue statements back-to-back.
+	Rate float64
+	// Arrival is the arrival process of the open-loop run, such as uniform and poisson.
+	Arrival string
+
+	// Ramp is the `start:end:step` concurrency of the ramp run, every step runs StepDuration.
+	Ramp         string
+	StepDuration time.Duration
+	// FindMax stops the ramp run when the p99 latency exceeds MaxP99 or the
+	// throughput gain of the step is less than MinGain, and reports the max step.
+	FindMax bool
+	MaxP99  time.Duration
+	MinGain float64
+
+	// ErrorPolicy is the policy of every error class, such as write-conflict=continue, see util.ClassifyError.
+	ErrorPolicy map[string]string
+	// MaxRetries is the max retry times of the operation whose error policy is retry.
+	MaxRetries int
+	// Asserts are the assertions checked after the run, such as p99<50ms and qps>1000.
+	Asserts []string
+
+	// OutputFormat is the format of the run result, such as text, json and csv.
+	OutputFormat string
+	// OutputFile is the file to write the run result, empty means stdout.
+	OutputFile string
+
+	// Command and Params are the running command and its flags, they are recorded in the run result.
+	Command string
+	Params  map[string]string
 }
 
 func (c *Config) String() string {
-	return fmt.Sprintf("concurrency: %v, host: %v, port: %v, user: %v, password: %v, db-name: %v",
-		c.Concurrency, c.Host, c.Port, c.User, c.Password, c.DBName)
+	return fmt.Sprintf("concurrency: %v, host: %v, host-file: %v, load-balance: %v, port: %v, user: %v, password: %v, db-name: %v, socket: %v, ssl-mode: %v, ssl-ca: %v, ssl-cert: %v, ssl-key: %v, dsn-param: %v, max-open-conns: %v, max-idle-conns: %v, conn-max-lifetime: %v, init-sql: %v, session-var: %v, global-var: %v, seed: %v, load-mode: %v, load-batch: %v, duration: %v, max-queries: %v, rate: %v, arrival: %v, ramp: %v, step-duration: %v, find-max: %v, max-p99: %v, min-gain: %v, error-policy: %v, max-retries: %v, assert: %v, output-format: %v, output-file: %v",
+		c.Concurrency, c.Host, c.HostFile, c.LoadBalance, c.Port, c.User, c.Password, c.DBName, c.Socket, c.SSLMode, c.SSLCA, c.SSLCert, c.SSLKey, c.DSNParams, c.MaxOpenConns, c.MaxIdleConns, c.ConnMaxLifetime, c.InitSQL, c.SessionVars, c.GlobalVars, c.Seed, c.LoadMode, c.LoadBatch, c.Duration, c.MaxQueries, c.Rate, c.Arrival, c.Ramp, c.StepDuration, c.FindMax, c.MaxP99, c.MinGain, c.ErrorPolicy, c.MaxRetries, c.Asserts, c.OutputFormat, c.OutputFile)
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Endpoint is a database server, Weight is used by the weight load balance policy.
+type Endpoint struct {
+	Host   string
+	Port   int
+	Weight int
+	// Socket is the unix socket file, Host and Port are ignored if it is set.
+	Socket string
+}
+
+// Net returns the network of the endpoint, unix or tcp.
+func (e Endpoint) Net() string {
+	if e.Socket != "" {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Addr returns the address of `host:port`, or the socket file.
+func (e Endpoint) Addr() string {
+	if e.Socket != "" {
+		return e.Socket
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+func (e Endpoint) String() string {
+	return e.Addr()
+}
+
+// Endpoints returns the endpoints of Host and HostFile. Host is a comma
+// separated list of `host[:port][=weight]`, HostFile has an endpoint of the
+// same format in every line. Port is used if the endpoint doesn't specify
+// the port, and the default weight is 1. Socket overrides them if it is set.
+func (c *DBConfig) Endpoints() ([]Endpoint, error) {
+	if c.Socket != "" {
+		return []Endpoint{{Socket: c.Socket, Weight: 1}}, nil
+	}
+	var items []string
+	for _, item := range strings.Split(c.Host, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if c.HostFile != "" {
+		file, err := os.Open(c.HostFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			items = append(items, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no database host is specified")
+	}
+	endpoints := make([]Endpoint, 0, len(items))
+	for _, item := range items {
+		e, err := c.parseEndpoint(item)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, nil
+}
+
+func (c *DBConfig) parseEndpoint(s string) (Endpoint, error) {
+	e := Endpoint{Host: s, Port: c.Port, Weight: 1}
+	if idx := strings.LastIndex(s, "="); idx >= 0 {
+		weight, err := strconv.Atoi(strings.TrimSpace(s[idx+1:]))
+		if err != nil || weight <= 0 {
+			return e, fmt.Errorf("invalid weight of endpoint %v, should be a positive integer", s)
+		}
+		e.Weight = weight
+		e.Host = strings.TrimSpace(s[:idx])
+	}
+	// the port is optional, and the IPv6 address with port is in brackets.
+	if strings.Count(e.Host, ":") == 1 || strings.HasPrefix(e.Host, "[") {
+		host, port, err := net.SplitHostPort(e.Host)
+		if err != nil {
+			return e, fmt.Errorf("invalid endpoint %v: %v", s, err)
+		}
+		e.Host = host
+		if e.Port, err = strconv.Atoi(port); err != nil {
+			return e, fmt.Errorf("invalid port of endpoint %v", s)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	c := &DBConfig{Port: 4000}
+	endpoints := map[string]Endpoint{
+		"127.0.0.1":       {Host: "127.0.0.1", Port: 4000, Weight: 1},
+		"tidb-0:4001":     {Host: "tidb-0", Port: 4001, Weight: 1},
+		"tidb-0=3":        {Host: "tidb-0", Port: 4000, Weight: 3},
+		"tidb-0:4001 = 2": {Host: "tidb-0", Port: 4001, Weight: 2},
+		// the IPv6 address without brackets uses the default port.
+		"::1":          {Host: "::1", Port: 4000, Weight: 1},
+		"[::1]:4002=5": {Host: "::1", Port: 4002, Weight: 5},
+	}
+	for s, expect := range endpoints {
+		e, err := c.parseEndpoint(s)
+		if err != nil || e != expect {
+			t.Errorf("%v: expect %+v, got %+v, %v", s, expect, e, err)
+		}
+	}
+	if e, _ := c.parseEndpoint("[::1]:4002"); e.Addr() != "[::1]:4002" {
+		t.Errorf("expect the address in brackets, got %v", e.Addr())
+	}
+
+	errs := map[string]string{
+		"tidb-0=0":    "invalid weight",
+		"tidb-0=a":    "invalid weight",
+		"tidb-0:port": "invalid port",
+		"[::1":        "invalid endpoint",
+	}
+	for s, msg := range errs {
+		if _, err := c.parseEndpoint(s); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%v: expect error %q, got %v", s, msg, err)
+		}
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostFile := filepath.Join(dir, "hosts")
+	if err := ioutil.WriteFile(hostFile, []byte("# tidb servers\ntidb-1:4001=2\n\n  tidb-2  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the endpoints of Host come first, the empty items and the comments are skipped.
+	c := &DBConfig{Host: "tidb-0, ,", Port: 4000, HostFile: hostFile}
+	endpoints, err := c.Endpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Endpoint{
+		{Host: "tidb-0", Port: 4000, Weight: 1},
+		{Host: "tidb-1", Port: 4001, Weight: 2},
+		{Host: "tidb-2", Port: 4000, Weight: 1},
+	}
+	if !reflect.DeepEqual(endpoints, expect) {
+		t.Errorf("expect %+v, got %+v", expect, endpoints)
+	}
+
+	// the socket overrides the endpoints.
+	c = &DBConfig{Host: "tidb-0,tidb-1", Port: 4000, Socket: "/tmp/tidb.sock"}
+	endpoints, err = c.Endpoints()
+	if err != nil || len(endpoints) != 1 || endpoints[0].Net() != "unix" || endpoints[0].Addr() != "/tmp/tidb.sock" {
+		t.Errorf("socket: expect the unix endpoint, got %+v, %v", endpoints, err)
+	}
+
+	c = &DBConfig{Host: " , "}
+	if _, err := c.Endpoints(); err == nil || !strings.Contains(err.Error(), "no database host") {
+		t.Errorf("expect no database host error, got %v", err)
+	}
+	c = &DBConfig{Host: "tidb-0", HostFile: filepath.Join(dir, "not-exist")}
+	if _, err := c.Endpoints(); !os.IsNotExist(err) {
+		t.Errorf("expect the not exist error of the host file, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// File is the TOML config file of `--config`, or the JSON config file of the
+// same structure if the file extension is .json. The top-level items are the
+// global settings, and the items in the table of a command, such as [bench]
+// or [case.write-conflict], are only for the command:
+//
+//	host = "127.0.0.1"
+//	port = 4000
+//	db-name = "test"
+//	concurrency = 10
+//
+//	[bench]
+//	concurrency = 50
+//	sql = "select * from t where id = ?"
+//
+//	[case.write-conflict]
+//	probability = 10
+//
+// The items of the more specific table override the outer ones.
+type File struct {
+	path  string
+	items map[string]interface{}
+}
+
+// FileItem is an item of the config file.
+type FileItem struct {
+	// Table is the table name of the item, it is empty for the top-level items.
+	Table string
+	Key   string
+	Value interface{}
+	// Leaf is true if the item belongs to the top-level or the table of the command itself.
+	Leaf bool
+}
+
+// LoadFile loads the TOML config file, or the JSON config file if the extension is .json.
+func LoadFile(path string) (*File, error) {
+	f := &File{path: path}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		if _, err := toml.DecodeFile(path, &f.items); err != nil {
+			return nil, fmt.Errorf("parse config file %v error: %v", path, err)
+		}
+		return f, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	// keep the numbers as they are written, such as 1000000 rather than 1e+06.
+	decoder.UseNumber()
+	if err := decoder.Decode(&f.items); err != nil {
+		return nil, fmt.Errorf("parse config file %v error: %v", path, err)
+	}
+	return f, nil
+}
+
+// Items returns the items for the command, cmdPath is the command names
+// under the root command, such as ["case", "write-conflict"]. The items
+// of the outer tables are returned first.
+func (f *File) Items(cmdPath []string) []FileItem {
+	var items []FileItem
+	table := f.items
+	for depth := 0; table != nil; depth++ {
+		var next map[string]interface{}
+		if depth < len(cmdPath) {
+			next, _ = table[cmdPath[depth]].(map[string]interface{})
+		}
+		name := strings.Join(cmdPath[:depth], ".")
+		leaf := depth == 0 || depth == len(cmdPath)
+		keys := make([]string, 0, len(table))
+		for key := range table {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if depth < len(cmdPath) && key == cmdPath[depth] {
+				continue
+			}
+			items = append(items, FileItem{Table: name, Key: key, Value: table[key], Leaf: leaf})
+		}
+		table = next
+	}
+	return items
+}
+
+// Path returns the path of the config file.
+func (f *File) Path() string {
+	return f.path
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Correlation makes the values of a column depend on another column. The key
+// of the column is the key of the referenced column plus a random noise in
+// [-Noise, Noise], so the column is functionally dependent on the referenced
+// column if Noise is 0.
+type Correlation struct {
+	Column string
+	Noise  int64
+
+	// ref is the index of the referenced column in the table.
+	ref int
+}
+
+// ParseCorrelation parses the correlation such as a or a:10, a is the
+// referenced column and 10 is the noise.
+func ParseCorrelation(s string) (*Correlation, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	c := &Correlation{Column: s}
+	if idx := strings.Index(s, ":"); idx >= 0 {
+		c.Column = strings.TrimSpace(s[:idx])
+		noise, err := strconv.ParseInt(strings.TrimSpace(s[idx+1:]), 10, 64)
+		if err != nil || noise < 0 {
+			return nil, fmt.Errorf("invalid noise of correlation %v, should be such as a:10", s)
+		}
+		c.Noise = noise
+	}
+	if c.Column == "" {
+		return nil, fmt.Errorf("correlation %v doesn't have the column", s)
+	}
+	return c, nil
+}
+
+func (c *Correlation) key(rnd *rand.Rand, refKey int64) int64 {
+	k := refKey
+	if c.Noise > 0 {
+		k += rnd.Int63n(2*c.Noise+1) - c.Noise
+	}
+	if k < 0 {
+		return 0
+	}
+	return k
+}
+
+// resolveCorrelations finds the referenced columns of the correlations, the
+// referenced column should be before the column.
+func (t *TableInfo) resolveCorrelations() error {
+	for i, col := range t.Columns {
+		if col.Corr == nil {
+			continue
+		}
+		col.Corr.ref = -1
+		for j := 0; j < i; j++ {
+			if strings.EqualFold(t.Columns[j].Name, col.Corr.Column) {
+				col.Corr.ref = j
+				break
+			}
+		}
+		if col.Corr.ref < 0 {
+			return fmt.Errorf("the correlated column %v of column %v should be defined before it", col.Corr.Column, col.Name)
+		}
+	}
+	return nil
+}
+
+// rowValues returns the values of the num-th row.
+func (t *TableInfo) rowValues(rnd *rand.Rand, num int) []interface{} {
+	keys := make([]int64, len(t.Columns))
+	values := make([]interface{}, len(t.Columns))
+	for i, col := range t.Columns {
+		if col.Corr != nil {
+			keys[i] = col.Corr.key(rnd, keys[col.Corr.ref])
+		} else {
+			keys[i] = col.key(rnd, int64(num), t.ExpectedRows)
+		}
+		values[i] = col.value(rnd, keys[i])
+	}
+	return values
+}
+
+// value returns the value of the key, or NULL by the NullRatio of the column.
+func (col *ColumnInfo) value(rnd *rand.Rand, key int64) interface{} {
+	if col.NullRatio > 0 && rnd.Float64() < col.NullRatio {
+		return nil
+	}
+	if col.Dist != nil {
+		switch col.Dist.Kind {
+		case DistConstant:
+			return col.Dist.Value
+		case DistRandom:
+			return col.randValue(rnd)
+		}
+	}
+	return col.seqValue(key)
+}
@@ -93,6 +93,8 @@ const (
 	TimeFormatForDATE = "2006-01-02"
 	TimeFormatForTIME = "15:04:05"
 
+	TimeFormatForDATETIME = "2006-01-02 15:04:05"
+
 	MINDATETIME = "2000-01-01 00:00:00"
 	MAXDATETIME = "2020-12-31 23:59:59"
 
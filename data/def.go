@@ -8,6 +8,16 @@ type ColumnDef struct {
 	DefaultValue string
 	MinValue     string
 	MaxValue     string
+	// JSONDepth is the max nesting depth of the generated JSON documents.
+	JSONDepth int
+	// Distribution is the distribution of the generated values, such as zipf:1.2,
+	// see ParseDistribution. The values are sequential if it is empty.
+	Distribution string
+	// NullRatio is the ratio of the NULL values in [0, 1].
+	NullRatio float64
+	// Correlation makes the column depend on a column before it, such as a or
+	// a:10, see ParseCorrelation.
+	Correlation string
 }
 
 func NewTableInfo(dbName, tableName string, colDefs []ColumnDef, indexs []IndexInfo) (*TableInfo, error) {
@@ -17,21 +27,42 @@ func NewTableInfo(dbName, tableName string, colDefs []ColumnDef, indexs []IndexI
 		if err != nil {
 			return nil, err
 		}
+		col.JSONDepth = colDef.JSONDepth
+		col.Dist, err = ParseDistribution(colDef.Distribution)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %w", colDef.Name, err)
+		}
+		if colDef.NullRatio < 0 || colDef.NullRatio > 1 {
+			return nil, fmt.Errorf("null ratio of column %v should be in [0, 1]", colDef.Name)
+		}
+		col.NullRatio = colDef.NullRatio
+		col.Corr, err = ParseCorrelation(colDef.Correlation)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %w", colDef.Name, err)
+		}
 		colInfos = append(colInfos, col)
 	}
-	return &TableInfo{
+	t := &TableInfo{
 		DBName:    dbName,
 		TableName: tableName,
 		Columns:   colInfos,
 		Indexs:    indexs,
-	}, nil
+	}
+	if err := t.resolveCorrelations(); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 func (col *ColumnInfo) getDefinition() string {
+	fieldType := col.fieldType
+	if col.Unsigned {
+		fieldType += " UNSIGNED"
+	}
 	if col.DefaultValue != nil {
-		return fmt.Sprintf("%s NULL DEFAULT %v", col.fieldType, col.getDefaultValueString())
+		return fmt.Sprintf("%s NULL DEFAULT %v", fieldType, col.getDefaultValueString())
 	} else {
-		return fmt.Sprintf("%s NULL", col.fieldType)
+		return fmt.Sprintf("%s NULL", fieldType)
 	}
 }
 
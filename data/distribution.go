@@ -0,0 +1,236 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The kinds of the distribution of the generated values.
+const (
+	DistUniform   = "uniform"
+	DistZipf      = "zipf"
+	DistNormal    = "normal"
+	DistHotspot   = "hotspot"
+	DistMonotonic = "monotonic"
+	DistCyclic    = "cyclic"
+	DistConstant  = "constant"
+	DistRandom    = "random"
+)
+
+// Distribution is the distribution of the generated values of a column. The
+// values are chosen from the domain of the column, which is [min, max] if both
+// are set, otherwise the row numbers of the table.
+type Distribution struct {
+	Kind string
+	// Skew is the s of zipf, it should be greater than 1, the larger the more skewed.
+	Skew float64
+	// Mean and Stddev are of normal, in the unit of the column value.
+	Mean   float64
+	Stddev float64
+	// HotRatio percent of the values fall into the HotRange percent of the domain.
+	HotRatio float64
+	HotRange float64
+	// Gap is the difference between the continuous monotonic values.
+	Gap int64
+	// Period is the number of the different cyclic values.
+	Period int64
+	// Value is the constant value.
+	Value string
+
+	// zipf is built once by the domain of the first generated value.
+	zipfOnce sync.Once
+	zipf     *zipfGen
+}
+
+// ParseDistribution parses the distribution such as uniform, zipf:1.2,
+// normal:5000,100, hotspot:90,10, monotonic:10, cyclic:100, constant:abc and random.
+func ParseDistribution(s string) (*Distribution, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	kind, args := s, ""
+	if idx := strings.Index(s, ":"); idx >= 0 {
+		kind, args = strings.TrimSpace(s[:idx]), strings.TrimSpace(s[idx+1:])
+	}
+	d := &Distribution{Kind: strings.ToLower(kind)}
+	if d.Kind == DistConstant {
+		d.Value = args
+		return d, nil
+	}
+	var nums []float64
+	if args != "" {
+		for _, arg := range strings.Split(args, ",") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid argument %v of distribution %v", arg, s)
+			}
+			nums = append(nums, v)
+		}
+	}
+	arg := func(i int, defaultValue float64) float64 {
+		if i < len(nums) {
+			return nums[i]
+		}
+		return defaultValue
+	}
+	switch d.Kind {
+	case DistUniform, DistRandom:
+	case DistZipf:
+		d.Skew = arg(0, 1.1)
+		if d.Skew <= 1 {
+			return nil, fmt.Errorf("the skew of distribution %v should be greater than 1", s)
+		}
+	case DistNormal:
+		if len(nums) != 2 || nums[1] < 0 {
+			return nil, fmt.Errorf("distribution %v should be such as normal:mean,stddev", s)
+		}
+		d.Mean, d.Stddev = nums[0], nums[1]
+	case DistHotspot:
+		d.HotRatio, d.HotRange = arg(0, 90), arg(1, 10)
+		if d.HotRatio < 0 || d.HotRatio > 100 || d.HotRange <= 0 || d.HotRange > 100 {
+			return nil, fmt.Errorf("distribution %v should be such as hotspot:90,10, the percents should be in (0, 100]", s)
+		}
+	case DistMonotonic:
+		d.Gap = int64(arg(0, 1))
+		if d.Gap < 1 {
+			return nil, fmt.Errorf("the gap of distribution %v should be positive", s)
+		}
+	case DistCyclic:
+		d.Period = int64(arg(0, 0))
+		if d.Period < 1 {
+			return nil, fmt.Errorf("distribution %v should be such as cyclic:100, the period should be positive", s)
+		}
+	default:
+		return nil, fmt.Errorf("unknown distribution %v, should be one of uniform, zipf, normal, hotspot, monotonic, cyclic, constant and random", s)
+	}
+	return d, nil
+}
+
+// offset returns the offset in [0, n) of the num-th value in the domain of size n.
+func (d *Distribution) offset(rnd *rand.Rand, num, n int64, min float64) int64 {
+	switch d.Kind {
+	case DistZipf:
+		// 0 is the most frequent.
+		d.zipfOnce.Do(func() {
+			d.zipf = newZipfGen(d.Skew, 1, uint64(n-1))
+		})
+		return int64(d.zipf.next(rnd))
+	case DistNormal:
+		v := int64(math.Round(rnd.NormFloat64()*d.Stddev + d.Mean - min))
+		if v < 0 {
+			return 0
+		}
+		if v >= n {
+			return n - 1
+		}
+		return v
+	case DistHotspot:
+		if rnd.Float64()*100 < d.HotRatio {
+			hot := int64(float64(n) * d.HotRange / 100)
+			if hot < 1 {
+				hot = 1
+			}
+			return rnd.Int63n(hot)
+		}
+		return rnd.Int63n(n)
+	case DistMonotonic:
+		// the value wraps if it is larger than max.
+		return num * d.Gap
+	case DistCyclic:
+		return num % d.Period
+	default:
+		return rnd.Int63n(n)
+	}
+}
+
+// key returns the key of the num-th row by the distribution of the column,
+// rows is the rows of the table. The value of the column is generated from the key.
+func (col *ColumnInfo) key(rnd *rand.Rand, num int64, rows int) int64 {
+	if col.Dist == nil || col.Dist.Kind == DistConstant || col.Dist.Kind == DistRandom {
+		return num
+	}
+	n, min := col.domain(rows)
+	return col.Dist.offset(rnd, num, n, min)
+}
+
+// domain returns the size and the min value of the domain of the column.
+func (col *ColumnInfo) domain(rows int) (int64, float64) {
+	n := int64(rows)
+	var min float64
+	switch v := col.MinValue.(type) {
+	case int64:
+		min = float64(v)
+		if max, ok := col.MaxValue.(int64); ok && max >= v {
+			n = max - v + 1
+		}
+	case uint64:
+		min = float64(v)
+		if max, ok := col.MaxValue.(uint64); ok && max >= v && max-v < math.MaxInt64 {
+			n = int64(max-v) + 1
+		}
+	case float64:
+		min = v
+		if max, ok := col.MaxValue.(float64); ok && max >= v {
+			n = int64(max-v) + 1
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n, min
+}
+
+// zipfGen is rand.Zipf whose rand is given by every call, so it is built once and
+// shared by the loaders, which generate the rows of every block by its own rand.
+// It generates the same values as rand.Zipf with the same rand.
+type zipfGen struct {
+	imax         float64
+	v            float64
+	q            float64
+	s            float64
+	oneminusQ    float64
+	oneminusQinv float64
+	hxm          float64
+	hx0minusHxm  float64
+}
+
+func newZipfGen(s, v float64, imax uint64) *zipfGen {
+	z := &zipfGen{imax: float64(imax), v: v, q: s}
+	z.oneminusQ = 1.0 - z.q
+	z.oneminusQinv = 1.0 / z.oneminusQ
+	z.hxm = z.h(z.imax + 0.5)
+	z.hx0minusHxm = z.h(0.5) - math.Exp(math.Log(z.v)*(-z.q)) - z.hxm
+	z.s = 1 - z.hinv(z.h(1.5)-math.Exp(-z.q*math.Log(z.v+1.0)))
+	return z
+}
+
+func (z *zipfGen) h(x float64) float64 {
+	return math.Exp(z.oneminusQ*math.Log(z.v+x)) * z.oneminusQinv
+}
+
+func (z *zipfGen) hinv(x float64) float64 {
+	return math.Exp(z.oneminusQinv*math.Log(z.oneminusQ*x)) - z.v
+}
+
+// next returns a zipf distributed value in [0, imax] by the rejection-inversion method.
+func (z *zipfGen) next(rnd *rand.Rand) uint64 {
+	k := 0.0
+	for {
+		r := rnd.Float64()
+		ur := z.hxm + r*z.hx0minusHxm
+		x := z.hinv(ur)
+		k = math.Floor(x + 0.5)
+		if k-x <= z.s {
+			break
+		}
+		if ur >= z.h(k+0.5)-math.Exp(-math.Log(k+z.v)*z.q) {
+			break
+		}
+	}
+	return uint64(k)
+}
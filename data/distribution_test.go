@@ -0,0 +1,170 @@
+package data
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestParseDistribution(t *testing.T) {
+	kinds := map[string]string{
+		"uniform":         DistUniform,
+		"Zipf: 1.2":       DistZipf,
+		"normal:5000,100": DistNormal,
+		"hotspot":         DistHotspot,
+		"monotonic:10":    DistMonotonic,
+		"cyclic:100":      DistCyclic,
+		"constant:a,b:c":  DistConstant,
+		"constant":        DistConstant,
+		"hotspot:80,20":   DistHotspot,
+		"normal:-5.5,0":   DistNormal,
+		"zipf":            DistZipf,
+		"monotonic":       DistMonotonic,
+	}
+	for s, kind := range kinds {
+		d, err := ParseDistribution(s)
+		if err != nil || d.Kind != kind {
+			t.Errorf("%v: expect kind %v, got %+v, %v", s, kind, d, err)
+		}
+	}
+	if d, err := ParseDistribution(" "); d != nil || err != nil {
+		t.Errorf("empty: expect no distribution, got %+v, %v", d, err)
+	}
+	if d, _ := ParseDistribution("constant:a,b:c"); d.Value != "a,b:c" {
+		t.Errorf("constant: expect the value a,b:c, got %v", d.Value)
+	}
+	if d, _ := ParseDistribution("hotspot"); d.HotRatio != 90 || d.HotRange != 10 {
+		t.Errorf("hotspot: expect the default 90,10, got %v,%v", d.HotRatio, d.HotRange)
+	}
+
+	for _, s := range []string{"zipf:1", "zipf:x", "normal:5000", "normal:1,-1", "hotspot:90,0", "hotspot:101", "monotonic:0", "cyclic", "foo"} {
+		if _, err := ParseDistribution(s); err == nil {
+			t.Errorf("%v: expect error", s)
+		}
+	}
+}
+
+// sample returns the values of the first n rows of the BIGINT column in [0, 999]
+// by the distribution, the values are generated by the random source of seed.
+func sample(t *testing.T, dist string, n int, seed int64) []int64 {
+	t.Helper()
+	d, err := ParseDistribution(dist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := &ColumnInfo{Name: "c", Tp: KindBigInt, MinValue: int64(0), MaxValue: int64(999), Dist: d}
+	rnd := rand.New(rand.NewSource(seed))
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = col.value(rnd, col.key(rnd, int64(i), 100)).(int64)
+		if values[i] < 0 || values[i] > 999 {
+			t.Fatalf("%v: value %v of row %v is out of the domain", dist, values[i], i)
+		}
+	}
+	return values
+}
+
+// ratio returns the ratio of the values in [low, high].
+func ratio(values []int64, low, high int64) float64 {
+	cnt := 0
+	for _, v := range values {
+		if v >= low && v <= high {
+			cnt++
+		}
+	}
+	return float64(cnt) / float64(len(values))
+}
+
+func TestRandomDistributions(t *testing.T) {
+	const n = 20000
+
+	values := sample(t, "uniform", n, 1)
+	if r := ratio(values, 0, 499); r < 0.47 || r > 0.53 {
+		t.Errorf("uniform: %v of the values are in the lower half", r)
+	}
+	if r := ratio(values, 900, 999); r < 0.08 || r > 0.12 {
+		t.Errorf("uniform: %v of the values are in the top 10%%", r)
+	}
+
+	// p(k) of zipf:1.5 is in proportion to (k+1)^-1.5, which is about 38% for 0.
+	values = sample(t, "zipf:1.5", n, 1)
+	if r0, r1, r10 := ratio(values, 0, 0), ratio(values, 1, 1), ratio(values, 10, 10); r0 < 0.33 || r0 > 0.43 || r1 >= r0 || r10 >= r1 {
+		t.Errorf("zipf: the ratios of 0, 1 and 10 are %v, %v and %v", r0, r1, r10)
+	}
+
+	values = sample(t, "normal:500,10", n, 1)
+	if r := ratio(values, 480, 520); r < 0.94 {
+		t.Errorf("normal: %v of the values are within 2 stddev", r)
+	}
+	if r := ratio(values, 490, 510); r < 0.65 || r > 0.72 {
+		t.Errorf("normal: %v of the values are within 1 stddev", r)
+	}
+	// the values out of the domain are clamped to the bounds.
+	values = sample(t, "normal:0,100", n, 1)
+	if r := ratio(values, 0, 0); r < 0.45 {
+		t.Errorf("normal: %v of the values are clamped to min", r)
+	}
+
+	// 90% of the values fall into the hot 10%, and the cold values may fall into it too.
+	values = sample(t, "hotspot:90,10", n, 1)
+	if r := ratio(values, 0, 99); r < 0.89 || r > 0.93 {
+		t.Errorf("hotspot: %v of the values are in the hot range", r)
+	}
+}
+
+func TestOrderedDistributions(t *testing.T) {
+	values := sample(t, "monotonic:10", 101, 1)
+	for i := 0; i < 100; i++ {
+		if values[i] != int64(i)*10 {
+			t.Fatalf("monotonic: expect %v of row %v, got %v", i*10, i, values[i])
+		}
+	}
+	// the values wrap after max.
+	if values[100] >= values[99] {
+		t.Errorf("monotonic: expect the value wraps after max, got %v", values[100])
+	}
+
+	values = sample(t, "cyclic:3", 7, 1)
+	for i, v := range values {
+		if v != int64(i%3) {
+			t.Errorf("cyclic: expect %v of row %v, got %v", i%3, i, v)
+		}
+	}
+
+	d, _ := ParseDistribution("constant:abc")
+	col := &ColumnInfo{Name: "c", Tp: KindVarChar, FiledTypeM: 10, Dist: d}
+	if v := col.value(nil, col.key(nil, 5, 100)); v != "abc" {
+		t.Errorf("constant: expect abc, got %v", v)
+	}
+	// the values are sequential without a distribution.
+	col = &ColumnInfo{Name: "c", Tp: KindBigInt}
+	if v := col.value(nil, col.key(nil, 5, 100)); v != int64(5) {
+		t.Errorf("no distribution: expect 5, got %v", v)
+	}
+}
+
+func TestDistributionSeed(t *testing.T) {
+	for _, dist := range []string{"uniform", "zipf:1.2", "normal:500,100", "hotspot:90,10"} {
+		if a, b := sample(t, dist, 100, 1), sample(t, dist, 100, 1); !reflect.DeepEqual(a, b) {
+			t.Errorf("%v: expect the same values by the same seed", dist)
+		}
+		if a, b := sample(t, dist, 100, 1), sample(t, dist, 100, 2); reflect.DeepEqual(a, b) {
+			t.Errorf("%v: expect different values by different seeds", dist)
+		}
+	}
+}
+
+func TestZipfGen(t *testing.T) {
+	// the shared generator takes the rand of every call and generates the same values as rand.Zipf.
+	for _, s := range []float64{1.1, 1.5, 3} {
+		for _, imax := range []uint64{0, 100, 1 << 40} {
+			expect := rand.NewZipf(rand.New(rand.NewSource(1)), s, 1, imax)
+			z, rnd := newZipfGen(s, 1, imax), rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				if v, e := z.next(rnd), expect.Uint64(); v != e {
+					t.Fatalf("zipf(%v, %v): expect %v of the %v-th value, got %v", s, imax, e, i, v)
+				}
+			}
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package data
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
@@ -9,14 +8,11 @@ import (
 	"github.com/crazycs520/testutil/util"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 )
 
 type LoadDataSuit struct {
-	cfg         *config.Config
-	insertCount int64
+	cfg *config.Config
 }
 
 func NewLoadDataSuit(cfg *config.Config) *LoadDataSuit {
@@ -25,22 +21,28 @@ func NewLoadDataSuit(cfg *config.Config) *LoadDataSuit {
 	}
 }
 
-func (c *LoadDataSuit) Prepare(t *TableInfo, rows, regionRowNum int) error {
+// Prepare creates the table and loads the rows unless the table already has
+// the rows generated by the seed, the loading stops once ctx is done.
+func (c *LoadDataSuit) Prepare(ctx context.Context, t *TableInfo, rows, regionRowNum int) error {
 	c.cfg.DBName = t.DBName
-	db := util.GetSQLCli(c.cfg)
+	t.ExpectedRows = rows
+	db, err := util.OpenDB(c.cfg, "")
+	if err != nil {
+		return err
+	}
 	defer func() {
 		db.Close()
 	}()
-	exist := c.checkTableExist(db, t, rows)
+	exist := c.checkTableExist(db, t, rows) && c.checkTableSeed(db, t)
 	if exist {
 		return nil
 	}
 
 	prepareSQLs := []string{
 		"drop table if exists " + t.DBTableName(),
-		t.createSQL(),
+		t.createSQL(c.cfg.Seed),
 	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
+	err = prepare(ctx, db, c.cfg.DBName, prepareSQLs)
 	if err != nil {
 		return err
 	}
@@ -51,91 +53,29 @@ func (c *LoadDataSuit) Prepare(t *TableInfo, rows, regionRowNum int) error {
 	// split region.
 	if rows > regionRowNum && regionRowNum > 0 {
 		split := fmt.Sprintf("split table %v between (0) and (%v) regions %v;", t.DBTableName(), rows, rows/regionRowNum)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		_, err := db.ExecContext(ctx, split)
+		splitCtx, cancel := context.WithTimeout(ctx, time.Second)
+		_, err := db.ExecContext(splitCtx, split)
 		if err != nil {
 			fmt.Printf("split region error: %v\n", err)
 		}
 		cancel()
 	}
-	return c.loadData(t, rows)
-}
-
-func (c *LoadDataSuit) loadData(t *TableInfo, rows int) error {
-	// prepare data.
-	step := (rows / c.cfg.Concurrency) + 1
-	if step < 10 {
-		return c.insertData(t, 0, rows)
-	}
-	var wg sync.WaitGroup
-	errCh := make(chan error, c.cfg.Concurrency)
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		wg.Add(1)
-		start := i * step
-		end := (i + 1) * step
-		if end > rows {
-			end = rows
-		}
-		go func() {
-			defer wg.Done()
-			err := c.insertData(t, start, end)
-			if err != nil {
-				fmt.Printf("insert data error: %v\n", err)
-				errCh <- err
-			}
-		}()
-	}
-	var err error
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		ticker := time.NewTicker(time.Second)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case err = <-errCh:
-				cancel()
-			case <-ticker.C:
-				fmt.Printf("inserted rows: %v \n", atomic.LoadInt64(&c.insertCount))
-			}
-		}
-	}()
-	wg.Wait()
-	if err == nil {
-		cancel()
-	}
-	return nil
+	return c.loadData(ctx, t, rows)
 }
 
-func (c *LoadDataSuit) insertData(t *TableInfo, start, end int) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	var err error
-	txn, err := db.Begin()
+// loadData loads the generated rows by the load mode of the config.
+func (c *LoadDataSuit) loadData(ctx context.Context, t *TableInfo, rows int) error {
+	db, err := util.OpenDB(c.cfg, t.DBName)
 	if err != nil {
 		return err
 	}
-	for i := start; i < end; i++ {
-		sql := t.insertSQL(i)
-		_, err = txn.Exec(sql)
-		if err != nil {
-			return err
-		}
-		if (i-start)%100 == 1 {
-			err = txn.Commit()
-			if err != nil {
-				return err
-			}
-			txn, err = db.Begin()
-			if err != nil {
-				return err
-			}
-		}
-		atomic.AddInt64(&c.insertCount, 1)
-	}
-	return txn.Commit()
+	defer db.Close()
+	return LoadRows(ctx, c.cfg, db, &Rows{
+		Table:   t.DBTableName(),
+		Count:   rows,
+		Gen:     t.rowValues,
+		Columns: t.Columns,
+	})
 }
 
 func (s *LoadDataSuit) checkTableExist(db *sql.DB, t *TableInfo, rows int) bool {
@@ -168,6 +108,28 @@ func (s *LoadDataSuit) checkTableExist(db *sql.DB, t *TableInfo, rows int) bool
 	return valid
 }
 
+// seedComment is the comment of the table generated by the seed.
+func seedComment(seed int64) string {
+	return fmt.Sprintf("testutil seed %v", seed)
+}
+
+// checkTableSeed checks the existing table is generated by the seed, which is
+// recorded in the table comment. The table of any seed is reused if `--seed`
+// is not given.
+func (c *LoadDataSuit) checkTableSeed(db *sql.DB, t *TableInfo) bool {
+	var comment string
+	query := fmt.Sprintf("select table_comment from information_schema.tables where table_schema = '%v' and table_name = '%v'", t.DBName, t.TableName)
+	if err := db.QueryRow(query).Scan(&comment); err != nil {
+		fmt.Printf("table %v comment error: %v\n", t.DBTableName(), err)
+		return false
+	}
+	if c.cfg.RandomSeed || comment == seedComment(c.cfg.Seed) {
+		return true
+	}
+	fmt.Printf("table %v is not generated by seed %v (comment: %q), regenerate it\n", t.DBTableName(), c.cfg.Seed, comment)
+	return false
+}
+
 func (t *TableInfo) getColumnNames() []string {
 	names := []string{}
 	for _, col := range t.Columns {
@@ -176,7 +138,8 @@ func (t *TableInfo) getColumnNames() []string {
 	return names
 }
 
-func (t *TableInfo) createSQL() string {
+// createSQL returns the create table statement, the seed of the data is recorded in the comment.
+func (t *TableInfo) createSQL(seed int64) string {
 	sql := fmt.Sprintf("CREATE TABLE `%s` (", t.TableName)
 	cols := t.Columns
 	for i, col := range cols {
@@ -195,36 +158,29 @@ func (t *TableInfo) createSQL() string {
 			sql += fmt.Sprintf(", primary key (%v)", strings.Join(idx.Columns, ","))
 		}
 	}
-	sql += ")"
+	sql += fmt.Sprintf(") COMMENT='%v'", seedComment(seed))
 	return sql
 }
 
-func (t *TableInfo) insertSQL(num int) string {
-	buf := bytes.NewBuffer(make([]byte, 0, 128))
-	buf.WriteString(fmt.Sprintf("insert into %v values (", t.DBTableName()))
-	for i, col := range t.Columns {
-		if i > 0 {
-			buf.WriteString(",")
-		}
-		v := col.seqValue(int64(num))
-		buf.WriteString(fmt.Sprintf("'%v'", v))
-	}
-	buf.WriteString(")")
-	return buf.String()
-}
-
 func (t *TableInfo) DBTableName() string {
 	return t.DBName + "." + t.TableName
 }
 
-func prepare(db *sql.DB, dbName string, sqls []string) error {
+// prepare creates the database and executes sqls in it, all the statements
+// are executed in one connection since `use` only affects the connection.
+func prepare(ctx context.Context, db *sql.DB, dbName string, sqls []string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 	ss := []string{
 		"create database if not exists " + dbName,
 		"use " + dbName,
 	}
 	sqls = append(ss, sqls...)
 	for _, s := range sqls {
-		_, err := db.Exec(s)
+		_, err := conn.ExecContext(ctx, s)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,327 @@
+package data
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/util"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The load modes of the generated rows.
+const (
+	// LoadModeInsert inserts a row per statement, and commits every batch rows.
+	LoadModeInsert = "insert"
+	// LoadModeBatch inserts batch rows per multi-row insert statement.
+	LoadModeBatch = "batch"
+	// LoadModeLoadData streams batch rows per `LOAD DATA LOCAL INFILE` statement.
+	LoadModeLoadData = "load-data"
+)
+
+// The default rows of a batch, see config.Config.LoadBatch.
+const (
+	defaultInsertBatch   = 100
+	defaultLoadDataBatch = 10000
+)
+
+// seedBlockRows is the rows generated by the same rand, the rand of every block
+// is derived from the seed and the block number, so the generated data doesn't
+// depend on the concurrency.
+const seedBlockRows = 100
+
+// Rows are the generated rows loaded by LoadRows.
+type Rows struct {
+	// Table is the table to load the rows into, such as db.t.
+	Table string
+	// Count is the number of the rows.
+	Count int
+	// Gen returns the column values of the i-th row, rnd is derived from the seed and the block of the row.
+	Gen func(rnd *rand.Rand, i int) []interface{}
+	// Columns are the columns of the values, nil means the values are plain
+	// numbers and strings of all the columns in the table order.
+	Columns []*ColumnInfo
+}
+
+// LoadRows loads the rows with the concurrency, the load mode and the batch of
+// cfg, and prints the progress every second.
+func LoadRows(ctx context.Context, cfg *config.Config, db *sql.DB, rows *Rows) error {
+	l, err := newRowLoader(cfg, db, rows)
+	if err != nil {
+		return err
+	}
+	concurrency := cfg.Concurrency
+	if concurrency < 1 || rows.Count/concurrency < 10 {
+		concurrency = 1
+	}
+	step := rows.Count/concurrency + 1
+	step = (step + seedBlockRows - 1) / seedBlockRows * seedBlockRows
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for start := 0; start < rows.Count; start += step {
+		end := start + step
+		if end > rows.Count {
+			end = rows.Count
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			if err := l.load(ctx, start, end); err != nil {
+				errCh <- err
+				cancel()
+			}
+		}(start, end)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	begin := time.Now()
+	last, lastTime := int64(0), begin
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			loaded := atomic.LoadInt64(&l.loaded)
+			fmt.Printf("inserted rows: %v, %.0f rows/s \n", loaded, float64(loaded-last)/now.Sub(lastTime).Seconds())
+			last, lastTime = loaded, now
+		case <-done:
+			select {
+			case err := <-errCh:
+				return fmt.Errorf("insert data error: %w", err)
+			default:
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			cost := time.Since(begin)
+			fmt.Printf("inserted rows: %v in %v by %v, %.0f rows/s \n", l.loaded, cost.Round(time.Millisecond), l.mode, float64(l.loaded)/cost.Seconds())
+			return nil
+		}
+	}
+}
+
+// rowLoader loads the rows of a range in batches by the load mode.
+type rowLoader struct {
+	db     *sql.DB
+	rows   *Rows
+	seed   int64
+	mode   string
+	batch  int
+	loaded int64
+}
+
+func newRowLoader(cfg *config.Config, db *sql.DB, rows *Rows) (*rowLoader, error) {
+	l := &rowLoader{
+		db:    db,
+		rows:  rows,
+		seed:  cfg.Seed,
+		mode:  cfg.LoadMode,
+		batch: cfg.LoadBatch,
+	}
+	if l.mode == "" {
+		l.mode = LoadModeBatch
+	}
+	switch l.mode {
+	case LoadModeInsert, LoadModeBatch:
+		if l.batch <= 0 {
+			l.batch = defaultInsertBatch
+		}
+	case LoadModeLoadData:
+		if l.batch <= 0 {
+			l.batch = defaultLoadDataBatch
+		}
+	default:
+		return nil, fmt.Errorf("unknown load mode %v, should be one of %v, %v and %v", l.mode, LoadModeInsert, LoadModeBatch, LoadModeLoadData)
+	}
+	return l, nil
+}
+
+// load loads the rows [start, end), start is the beginning of a seed block.
+func (l *rowLoader) load(ctx context.Context, start, end int) error {
+	var rnd *rand.Rand
+	gen := func(i int) []interface{} {
+		if i == start || i%seedBlockRows == 0 {
+			rnd = util.NewRand(l.seed, int64(i/seedBlockRows))
+		}
+		return l.rows.Gen(rnd, i)
+	}
+	for i := start; i < end; i += l.batch {
+		n := l.batch
+		if n > end-i {
+			n = end - i
+		}
+		var err error
+		switch l.mode {
+		case LoadModeInsert:
+			err = l.insert(ctx, gen, i, i+n)
+		case LoadModeBatch:
+			err = l.insertBatch(ctx, gen, i, i+n)
+		case LoadModeLoadData:
+			err = l.loadData(ctx, gen, i, i+n)
+		}
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&l.loaded, int64(n))
+	}
+	return nil
+}
+
+// insert inserts the rows one by one in a transaction.
+func (l *rowLoader) insert(ctx context.Context, gen func(i int) []interface{}, start, end int) error {
+	txn, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for i := start; i < end; i++ {
+		var sql strings.Builder
+		sql.WriteString("insert into " + l.rows.Table + " values ")
+		l.writeValues(&sql, gen(i))
+		if _, err := txn.ExecContext(ctx, sql.String()); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// insertBatch inserts the rows in a multi-row insert statement.
+func (l *rowLoader) insertBatch(ctx context.Context, gen func(i int) []interface{}, start, end int) error {
+	var sql strings.Builder
+	sql.WriteString("insert into " + l.rows.Table + " values ")
+	for i := start; i < end; i++ {
+		if i > start {
+			sql.WriteString(",")
+		}
+		l.writeValues(&sql, gen(i))
+	}
+	_, err := l.db.ExecContext(ctx, sql.String())
+	return err
+}
+
+func (l *rowLoader) writeValues(sql *strings.Builder, values []interface{}) {
+	sql.WriteString("(")
+	for i, v := range values {
+		if i > 0 {
+			sql.WriteString(",")
+		}
+		if l.rows.Columns != nil {
+			sql.WriteString(l.rows.Columns[i].valueString(v))
+		} else {
+			sql.WriteString(literal(v))
+		}
+	}
+	sql.WriteString(")")
+}
+
+// literal returns the SQL literal of the plain value.
+func literal(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return valueNull
+	case []byte:
+		return fmt.Sprintf("x'%x'", x)
+	case string:
+		return quoteString(x)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// readerSeq makes the names of the registered readers unique.
+var readerSeq int64
+
+// loadData streams the rows to the server by `LOAD DATA LOCAL INFILE` from a
+// reader registered to the driver, the rows are generated while the server reads.
+func (l *rowLoader) loadData(ctx context.Context, gen func(i int) []interface{}, start, end int) error {
+	name := fmt.Sprintf("testutil-%v", atomic.AddInt64(&readerSeq, 1))
+	pr, pw := io.Pipe()
+	mysql.RegisterReaderHandler(name, func() io.Reader { return pr })
+	defer mysql.DeregisterReaderHandler(name)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w := bufio.NewWriterSize(pw, 64*1024)
+		for i := start; i < end; i++ {
+			if err := l.writeLine(w, gen(i)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(w.Flush())
+	}()
+	_, err := l.db.ExecContext(ctx, l.loadDataSQL(name))
+	// unblock the writer if the server doesn't read all the rows.
+	pr.Close()
+	<-done
+	return err
+}
+
+func (l *rowLoader) loadDataSQL(name string) string {
+	sql := fmt.Sprintf(`LOAD DATA LOCAL INFILE 'Reader::%v' INTO TABLE %v FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n'`, name, l.rows.Table)
+	if l.rows.Columns == nil {
+		return sql
+	}
+	// the BIT values are loaded by numbers, since the text of a field is the bytes of the bits.
+	var cols, sets []string
+	for i, col := range l.rows.Columns {
+		if col.Tp == KindBit {
+			cols = append(cols, fmt.Sprintf("@v%v", i))
+			sets = append(sets, fmt.Sprintf("`%v` = cast(@v%v as unsigned)", col.Name, i))
+		} else {
+			cols = append(cols, fmt.Sprintf("`%v`", col.Name))
+		}
+	}
+	sql += " (" + strings.Join(cols, ",") + ")"
+	if len(sets) > 0 {
+		sql += " SET " + strings.Join(sets, ",")
+	}
+	return sql
+}
+
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+// writeLine writes the values as a line of tab separated fields, NULL is \N.
+func (l *rowLoader) writeLine(w *bufio.Writer, values []interface{}) error {
+	for i, v := range values {
+		if i > 0 {
+			w.WriteByte('\t')
+		}
+		switch x := v.(type) {
+		case nil:
+			w.WriteString(`\N`)
+		case []byte:
+			fieldEscaper.WriteString(w, string(x))
+		case string:
+			if l.rows.Columns != nil && l.rows.Columns[i].Tp == KindBit {
+				n, err := strconv.ParseUint(x, 2, 64)
+				if err != nil {
+					return fmt.Errorf("invalid bit value %v: %w", x, err)
+				}
+				w.WriteString(strconv.FormatUint(n, 10))
+			} else {
+				fieldEscaper.WriteString(w, x)
+			}
+		default:
+			fieldEscaper.WriteString(w, fmt.Sprintf("%v", v))
+		}
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
@@ -1,7 +1,10 @@
 package data
 
 import (
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -27,6 +30,16 @@ type ColumnInfo struct {
 	DefaultValue interface{}
 	MinValue     interface{}
 	MaxValue     interface{}
+	// Elems are the members of ENUM and SET.
+	Elems []string
+	// JSONDepth is the max nesting depth of the generated JSON documents, the default is 2.
+	JSONDepth int
+	// Dist is the distribution of the generated values, the values are sequential if it is nil.
+	Dist *Distribution
+	// NullRatio is the ratio of the NULL values in [0, 1].
+	NullRatio float64
+	// Corr is the correlation with another column.
+	Corr *Correlation
 }
 
 const (
@@ -41,16 +54,21 @@ type IndexInfo struct {
 }
 
 func NewColumnInfo(name, tp string, defaultValueStr, minValueStr, maxValueStr string) (*ColumnInfo, error) {
+	// the members of ENUM and SET keep the case.
+	elemsStr := ""
+	if idx := strings.Index(tp, "("); idx > 0 {
+		elemsStr = tp[idx:]
+	}
 	tp = strings.ToLower(tp)
-	tpPrefix := tp
-	tpSuffix := ""
 	unsigned := false
-	if idx := strings.Index(tp, "unsigned"); idx > 0 {
+	if idx := strings.Index(tp, "unsigned"); idx > 0 && !strings.Contains(tp[:idx], "'") {
 		tp = strings.TrimSpace(tp[:idx])
 		unsigned = true
 	}
+	tpPrefix := tp
+	tpSuffix := ""
 	if idx := strings.Index(tp, "("); idx > 0 {
-		tpPrefix = tp[:idx]
+		tpPrefix = strings.TrimSpace(tp[:idx])
 		tpSuffix = strings.TrimSpace(tp[idx:])
 	}
 
@@ -64,6 +82,19 @@ func NewColumnInfo(name, tp string, defaultValueStr, minValueStr, maxValueStr st
 		Name:      name,
 		Unsigned:  unsigned,
 	}
+	if k == KindEnum || k == KindSet {
+		elems, err := parseElems(elemsStr)
+		if err != nil {
+			return nil, fmt.Errorf("unknown column tp: %v of column %v, %v", tp, name, err)
+		}
+		col.Elems = elems
+		quoted := make([]string, 0, len(elems))
+		for _, e := range elems {
+			quoted = append(quoted, quoteString(e))
+		}
+		col.fieldType = fmt.Sprintf("%s(%s)", ALLFieldType[k], strings.Join(quoted, ","))
+		tpSuffix = ""
+	}
 	defaultValue, err := col.convertValue(defaultValueStr)
 	if err != nil {
 		return nil, fmt.Errorf("parse default value error, tp is %v, error is %v", tpPrefix, err)
@@ -109,6 +140,12 @@ func NewColumnInfo(name, tp string, defaultValueStr, minValueStr, maxValueStr st
 
 var str2ColumnTP = map[string]int{
 	"bit":        KindBit,
+	"blob":       KindBLOB,
+	"bool":       KindBool,
+	"boolean":    KindBool,
+	"longblob":   KindLONGBLOB,
+	"mediumblob": KindMEDIUMBLOB,
+	"tinyblob":   KindTINYBLOB,
 	"text":       KindTEXT,
 	"date":       KindDATE,
 	"datetime":   KindDATETIME,
@@ -134,78 +171,91 @@ var str2ColumnTP = map[string]int{
 }
 
 // randValue return a rand value of the column
-func (col *ColumnInfo) randValue() interface{} {
+func (col *ColumnInfo) randValue(rnd *rand.Rand) interface{} {
 	switch col.Tp {
 	case KindTINYINT:
 		if col.Unsigned {
-			return rand.Int31n(1 << 8)
+			return rnd.Int31n(1 << 8)
 		}
-		return rand.Int31n(1<<8) - 1<<7
+		return rnd.Int31n(1<<8) - 1<<7
 	case KindSMALLINT:
 		if col.Unsigned {
-			return rand.Int31n(1 << 16)
+			return rnd.Int31n(1 << 16)
 		}
-		return rand.Int31n(1<<16) - 1<<15
+		return rnd.Int31n(1<<16) - 1<<15
 	case KindMEDIUMINT:
 		if col.Unsigned {
-			return rand.Int31n(1 << 24)
+			return rnd.Int31n(1 << 24)
 		}
-		return rand.Int31n(1<<24) - 1<<23
+		return rnd.Int31n(1<<24) - 1<<23
 	case KindInt32:
 		if col.Unsigned {
-			return rand.Int63n(1 << 32)
+			return rnd.Int63n(1 << 32)
 		}
-		return rand.Int63n(1<<32) - 1<<31
+		return rnd.Int63n(1<<32) - 1<<31
 	case KindBigInt:
-		if rand.Intn(2) == 1 || col.Unsigned {
-			return rand.Int63()
+		if rnd.Intn(2) == 1 || col.Unsigned {
+			return rnd.Int63()
 		}
-		return -1 - rand.Int63()
+		return -1 - rnd.Int63()
 	case KindBit:
-		if col.FiledTypeM >= 64 {
-			return fmt.Sprintf("%b", rand.Uint64())
-		} else {
-			m := col.FiledTypeM
-			if col.FiledTypeM > 7 { // it is a bug
-				m = m - 1
-			}
-			n := (int64)((1 << (uint)(m)) - 1)
-			return fmt.Sprintf("%b", rand.Int63n(n))
+		v := rnd.Uint64()
+		if m := col.bitLen(); m < 64 {
+			v &= 1<<uint(m) - 1
 		}
+		return fmt.Sprintf("%b", v)
 	case KindFloat:
-		return rand.Float32() + 1
+		return rnd.Float32() + 1
 	case KindDouble:
-		return rand.Float64() + 1
+		return rnd.Float64() + 1
 	case KindDECIMAL:
-		if col.Unsigned {
-			value := RandDecimal(col.FiledTypeM, col.FiledTypeD)
-			if len(value) > 0 && value[0] == '-' {
-				return value[1:]
-			}
+		m, d := col.decimalLen()
+		value := RandDecimal(rnd, m, d)
+		if col.Unsigned && len(value) > 0 && value[0] == '-' {
+			return value[1:]
 		}
-		return RandDecimal(col.FiledTypeM, col.FiledTypeD)
-	case KindChar, KindVarChar, KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
+		return value
+	case KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB:
+		b := make([]byte, rnd.Intn(col.blobLen()+1))
+		rnd.Read(b)
+		return b
+	case KindChar, KindVarChar, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
 		if col.FiledTypeM == 0 {
 			return ""
 		} else {
-			return RandSeq(rand.Intn(col.FiledTypeM))
+			return RandSeq(rnd, rnd.Intn(col.FiledTypeM))
 		}
 	case KindBool:
-		return rand.Intn(2)
+		return rnd.Intn(2)
 	case KindDATE:
-		randTime := time.Unix(MinDATETIME.Unix()+rand.Int63n(GapDATETIMEUnix), 0)
+		randTime := time.Unix(MinDATETIME.Unix()+rnd.Int63n(GapDATETIMEUnix), 0)
 		return randTime.Format(TimeFormatForDATE)
 	case KindTIME:
-		randTime := time.Unix(MinTIMESTAMP.Unix()+rand.Int63n(GapTIMESTAMPUnix), 0)
+		randTime := time.Unix(MinTIMESTAMP.Unix()+rnd.Int63n(GapTIMESTAMPUnix), 0)
 		return randTime.Format(TimeFormatForTIME)
 	case KindDATETIME:
-		randTime := randTime(MinDATETIME, GapDATETIMEUnix)
+		randTime := randTime(rnd, MinDATETIME, GapDATETIMEUnix)
 		return randTime.Format(TimeFormat)
 	case KindTIMESTAMP:
-		randTime := randTime(MinTIMESTAMP, GapTIMESTAMPUnix)
+		randTime := randTime(rnd, MinTIMESTAMP, GapTIMESTAMPUnix)
 		return randTime.Format(TimeFormat)
 	case KindYEAR:
-		return rand.Intn(254) + 1901 //1901 ~ 2155
+		return rnd.Intn(254) + 1901 //1901 ~ 2155
+	case KindJSON:
+		return jsonString(randJSON(rnd, col.jsonDepth()))
+	case KindEnum:
+		if len(col.Elems) == 0 {
+			return ""
+		}
+		return col.Elems[rnd.Intn(len(col.Elems))]
+	case KindSet:
+		members := make([]string, 0, len(col.Elems))
+		for _, e := range col.Elems {
+			if rnd.Intn(2) == 1 {
+				members = append(members, e)
+			}
+		}
+		return strings.Join(members, ",")
 	default:
 		return nil
 	}
@@ -241,17 +291,11 @@ func (col *ColumnInfo) seqValue(num int64) interface{} {
 		}
 		return v
 	case KindBit:
-		//if col.FiledTypeM >= 64 {
-		//	return fmt.Sprintf("%b", rand.Uint64())
-		//} else {
-		//	m := col.FiledTypeM
-		//	if col.FiledTypeM > 7 { // it is a bug
-		//		m = m - 1
-		//	}
-		//	n := (int64)((1 << (uint)(m)) - 1)
-		//	return fmt.Sprintf("%b", rand.Int63n(n))
-		//}
-		return nil
+		m := col.bitLen()
+		if m >= 64 {
+			return fmt.Sprintf("%b", uint64(num))
+		}
+		return fmt.Sprintf("%b", uint64(num)%(1<<uint(m)))
 	case KindFloat, KindDouble:
 		v := float64(num)
 		if col.MinValue != nil {
@@ -266,9 +310,35 @@ func (col *ColumnInfo) seqValue(num int64) interface{} {
 		}
 		return v
 	case KindDECIMAL:
-		return nil
-		//return RandDecimal(col.FiledTypeM, col.FiledTypeD)
-	case KindChar, KindVarChar, KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
+		m, d := col.decimalLen()
+		v := float64(num)
+		if col.MinValue != nil {
+			min := col.MinValue.(float64)
+			v = min + float64(num)
+			if col.MaxValue != nil {
+				max := col.MaxValue.(float64)
+				// wrap into [min, max] by the step of 1, the fraction of min is kept.
+				if max <= min {
+					v = min
+				} else if v > max {
+					v = min + math.Mod(float64(num), math.Floor(max-min)+1)
+				}
+			}
+		}
+		// keep the integer digits in m-d.
+		v = math.Mod(v, math.Pow10(m-d))
+		if col.Unsigned && v < 0 {
+			v = -v
+		}
+		return strconv.FormatFloat(v, 'f', d, 64)
+	case KindBLOB, KindTINYBLOB, KindMEDIUMBLOB, KindLONGBLOB:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(num))
+		if l := col.blobLen(); l < len(b) {
+			b = b[len(b)-l:]
+		}
+		return b
+	case KindChar, KindVarChar, KindTEXT, KindTINYTEXT, KindMEDIUMTEXT, KindLONGTEXT:
 		if col.FiledTypeM == 0 {
 			return ""
 		} else {
@@ -286,6 +356,22 @@ func (col *ColumnInfo) seqValue(num int64) interface{} {
 		return time.Now().Format(TimeFormat)
 	case KindYEAR:
 		return num%254 + 1901 //1901 ~ 2155
+	case KindJSON:
+		return jsonString(seqJSON(num, col.jsonDepth()))
+	case KindEnum:
+		if len(col.Elems) == 0 {
+			return ""
+		}
+		return col.Elems[num%int64(len(col.Elems))]
+	case KindSet:
+		// the bits of num choose the members.
+		members := make([]string, 0, len(col.Elems))
+		for i, e := range col.Elems {
+			if i < 63 && num&(1<<uint(i)) != 0 {
+				members = append(members, e)
+			}
+		}
+		return strings.Join(members, ",")
 	default:
 		return nil
 	}
@@ -323,17 +409,19 @@ func (col *ColumnInfo) convertValue(value string) (interface{}, error) {
 		return time.ParseInLocation(TimeFormat, value, Local)
 	case KindYEAR:
 		return strconv.ParseInt(value, 10, 64) //1901 ~ 2155
+	case KindJSON, KindEnum, KindSet:
+		return value, nil
 	default:
 		return nil, nil
 	}
 }
 
-func randTime(minTime time.Time, gap int64) time.Time {
+func randTime(rnd *rand.Rand, minTime time.Time, gap int64) time.Time {
 	// https://github.com/chronotope/chrono-tz/issues/23
 	// see all invalid time: https://timezonedb.com/time-zones/Asia/Shanghai
 	var randTime time.Time
 	for {
-		randTime = time.Unix(minTime.Unix()+rand.Int63n(gap), 0).In(Local)
+		randTime = time.Unix(minTime.Unix()+rnd.Int63n(gap), 0).In(Local)
 		if NotAmbiguousTime(randTime) {
 			break
 		}
@@ -341,9 +429,9 @@ func randTime(minTime time.Time, gap int64) time.Time {
 	return randTime
 }
 
-func RandDecimal(m, d int) string {
-	ms := randNum(m - d)
-	ds := randNum(d)
+func RandDecimal(rnd *rand.Rand, m, d int) string {
+	ms := randNum(rnd, m-d)
+	ds := randNum(rnd, d)
 	var i int
 	for i = range ms {
 		if ms[i] != byte('0') {
@@ -352,7 +440,7 @@ func RandDecimal(m, d int) string {
 	}
 	ms = ms[i:]
 	l := len(ms) + len(ds) + 1
-	flag := rand.Intn(2)
+	flag := rnd.Intn(2)
 	//check for 0.0... avoid -0.0
 	zeroFlag := true
 	for i := range ms {
@@ -383,10 +471,10 @@ func RandDecimal(m, d int) string {
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyz1234567890"
 
-func RandSeq(n int) string {
+func RandSeq(rnd *rand.Rand, n int) string {
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+		b[i] = letterBytes[rnd.Intn(len(letterBytes))]
 	}
 	return string(b)
 }
@@ -402,10 +490,176 @@ func intToSeqString(n int) string {
 
 const numberBytes = "0123456789"
 
-func randNum(n int) []byte {
+func randNum(rnd *rand.Rand, n int) []byte {
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = numberBytes[rand.Int63()%int64(len(numberBytes))]
+		b[i] = numberBytes[rnd.Int63()%int64(len(numberBytes))]
 	}
 	return b
 }
+
+// valueString returns the SQL literal of the value v of the column.
+func (col *ColumnInfo) valueString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return valueNull
+	case []byte:
+		if len(x) == 0 {
+			return "''"
+		}
+		return fmt.Sprintf("x'%x'", x)
+	case string:
+		if col.Tp == KindBit {
+			return fmt.Sprintf("b'%v'", x)
+		}
+		return quoteString(x)
+	}
+	return fmt.Sprintf("'%v'", v)
+}
+
+// bitLen returns M of BIT(M), the default is 1.
+func (col *ColumnInfo) bitLen() int {
+	if col.FiledTypeM <= 0 {
+		return 1
+	}
+	return col.FiledTypeM
+}
+
+// decimalLen returns M and D of DECIMAL(M,D), the default is DECIMAL(10,0).
+func (col *ColumnInfo) decimalLen() (int, int) {
+	m, d := col.FiledTypeM, col.FiledTypeD
+	if m <= 0 {
+		m = 10
+	}
+	if d > m {
+		d = m
+	}
+	return m, d
+}
+
+// defaultBlobLen is the max length of the generated blobs without the length.
+const defaultBlobLen = 64
+
+// blobLen returns the max length of the generated blobs.
+func (col *ColumnInfo) blobLen() int {
+	l := col.FiledTypeM
+	if l <= 0 {
+		l = defaultBlobLen
+	}
+	if col.Tp == KindTINYBLOB && l > 255 {
+		l = 255
+	}
+	return l
+}
+
+func (col *ColumnInfo) jsonDepth() int {
+	if col.JSONDepth <= 0 {
+		return 2
+	}
+	return col.JSONDepth
+}
+
+// parseElems parses the members of ENUM and SET, such as ('a','b').
+func parseElems(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return nil, fmt.Errorf("the members should be such as ('a','b')")
+	}
+	s = s[1 : len(s)-1]
+	var elems []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == ',':
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				} else if s[j] == c {
+					// the doubled quote is an escaped quote.
+					if j+1 < len(s) && s[j+1] == c {
+						j++
+					} else {
+						break
+					}
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unclosed quote of the members")
+			}
+			elems = append(elems, b.String())
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("the members should be quoted")
+		}
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("no members")
+	}
+	return elems, nil
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// randJSON returns a random JSON object whose nesting depth is not more than depth.
+func randJSON(rnd *rand.Rand, depth int) interface{} {
+	obj := make(map[string]interface{})
+	for i, n := 0, rnd.Intn(4)+1; i < n; i++ {
+		obj[RandSeq(rnd, rnd.Intn(8)+1)] = randJSONValue(rnd, depth-1)
+	}
+	return obj
+}
+
+func randJSONValue(rnd *rand.Rand, depth int) interface{} {
+	kinds := 5
+	if depth > 0 {
+		kinds = 7
+	}
+	switch rnd.Intn(kinds) {
+	case 0:
+		return rnd.Int63n(1<<32) - 1<<31
+	case 1:
+		return rnd.Float64() * 1000
+	case 2:
+		return RandSeq(rnd, rnd.Intn(16))
+	case 3:
+		return rnd.Intn(2) == 1
+	case 4:
+		return nil
+	case 5:
+		arr := make([]interface{}, rnd.Intn(4))
+		for i := range arr {
+			arr[i] = randJSONValue(rnd, depth-1)
+		}
+		return arr
+	default:
+		return randJSON(rnd, depth)
+	}
+}
+
+// seqJSON returns a JSON object of num whose nesting depth is depth.
+func seqJSON(num int64, depth int) interface{} {
+	obj := map[string]interface{}{
+		"id":   num,
+		"name": intToSeqString(int(num)),
+	}
+	if depth > 1 {
+		obj["tags"] = []interface{}{num % 10, num % 100}
+		obj["child"] = seqJSON(num, depth-1)
+	}
+	return obj
+}
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDecimalSeqValueRange(t *testing.T) {
+	ranges := [][2]float64{{0, 0.5}, {-0.9, -0.1}, {1.25, 3.75}, {-2.5, 2.5}, {10, 10}, {5, 1}}
+	for _, r := range ranges {
+		col := &ColumnInfo{Name: "d", Tp: KindDECIMAL, FiledTypeM: 10, FiledTypeD: 2, MinValue: r[0], MaxValue: r[1]}
+		seen := make(map[string]bool)
+		for num := int64(0); num < 100; num++ {
+			s := col.seqValue(num).(string)
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				t.Fatalf("[%v, %v]: invalid decimal %v", r[0], r[1], s)
+			}
+			if v < r[0] || (v > r[1] && r[1] > r[0]) {
+				t.Fatalf("[%v, %v]: value %v of row %v is out of range", r[0], r[1], s, num)
+			}
+			seen[s] = true
+		}
+		// the values step by 1 from min, so the range of width w has floor(w)+1 distinct values.
+		if r[1] > r[0] && len(seen) != int(r[1]-r[0])+1 {
+			t.Errorf("[%v, %v]: expect %v distinct values, got %v", r[0], r[1], int(r[1]-r[0])+1, len(seen))
+		}
+	}
+	col := &ColumnInfo{Name: "d", Tp: KindDECIMAL, FiledTypeM: 10, FiledTypeD: 2, MinValue: 1.25, MaxValue: 3.75}
+	for num, expect := range []string{"1.25", "2.25", "3.25", "1.25", "2.25"} {
+		if v := col.seqValue(int64(num)); v != expect {
+			t.Errorf("row %v: expect %v, got %v", num, expect, v)
+		}
+	}
+}
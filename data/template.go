@@ -0,0 +1,437 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Template is one or more SQL statements with placeholders. A placeholder is
+// written as `{{name:generator(args...)}}`, `{{generator(args...)}}` or `{{name}}`.
+// The named placeholder is generated once per execution, so `{{name}}` reuses
+// the value in all the statements of the template. Supported generators:
+//
+//	int(min, max)             uniform integer in [min, max]
+//	zipf(min, max[, s])       zipf distributed integer in [min, max], s > 1 is the skew, default 1.1
+//	str(len) / str(min, max)  random string with the length in [min, max]
+//	date(start, end)          random date in [start, end], such as date('2020-01-01', '2020-12-31')
+//	datetime(start, end)      random datetime in [start, end]
+//	pick(v1, v2, ...)         pick one of the values
+//	uuid()                    random uuid
+//	seq([start])              sequence of the worker, start from start, default 1
+//	gseq([start])             sequence shared by all workers, start from start, default 1
+type Template struct {
+	stmts [][]segment
+	gens  []*generator
+	names map[string]int
+}
+
+type segment struct {
+	text string
+	// gen is the index of the placeholder generator, -1 means the segment is text.
+	gen int
+}
+
+// ParseTemplate parses the sqls into one template, vars are the named
+// placeholders which can be used as `{{name}}` in the sqls.
+func ParseTemplate(vars map[string]string, sqls ...string) (*Template, error) {
+	t := &Template{names: make(map[string]int)}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	// sort the names to make the generators order deterministic.
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := t.addPlaceholder(name + ":" + vars[name]); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range sqls {
+		stmt, err := t.parse(s)
+		if err != nil {
+			return nil, err
+		}
+		t.stmts = append(t.stmts, stmt)
+	}
+	return t, nil
+}
+
+func (t *Template) parse(s string) ([]segment, error) {
+	var segs []segment
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in sql: %v", s)
+		}
+		end += start
+		if start > 0 {
+			segs = append(segs, segment{text: s[:start], gen: -1})
+		}
+		idx, err := t.addPlaceholder(strings.TrimSpace(s[start+2 : end]))
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, segment{gen: idx})
+		s = s[end+2:]
+	}
+	if len(s) > 0 {
+		segs = append(segs, segment{text: s, gen: -1})
+	}
+	return segs, nil
+}
+
+func (t *Template) addPlaceholder(p string) (int, error) {
+	name, spec := "", p
+	if idx := strings.Index(p, ":"); idx >= 0 && strings.Index(p, "(") > idx {
+		name, spec = strings.TrimSpace(p[:idx]), strings.TrimSpace(p[idx+1:])
+	} else if !strings.Contains(p, "(") {
+		name, spec = p, ""
+	}
+	if spec == "" {
+		idx, ok := t.names[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown placeholder: %v", name)
+		}
+		return idx, nil
+	}
+	if _, ok := t.names[name]; ok && name != "" {
+		return 0, fmt.Errorf("duplicate placeholder: %v", name)
+	}
+	gen, err := parseGenerator(spec)
+	if err != nil {
+		return 0, fmt.Errorf("parse placeholder %v error: %v", p, err)
+	}
+	t.gens = append(t.gens, gen)
+	idx := len(t.gens) - 1
+	if name != "" {
+		t.names[name] = idx
+	}
+	return idx, nil
+}
+
+// NumStmts returns the number of statements in the template.
+func (t *Template) NumStmts() int {
+	return len(t.stmts)
+}
+
+// NewRenderer returns a renderer of the template. The renderer isn't safe for
+// concurrent use, every worker should have its own renderer.
+func (t *Template) NewRenderer(rnd *rand.Rand) *Renderer {
+	return &Renderer{
+		t:      t,
+		rnd:    rnd,
+		states: make([]genState, len(t.gens)),
+		values: make([]interface{}, len(t.gens)),
+	}
+}
+
+// Renderer generates the placeholder values and renders the statements.
+type Renderer struct {
+	t      *Template
+	rnd    *rand.Rand
+	states []genState
+	values []interface{}
+}
+
+// genState is the generator state of a renderer.
+type genState struct {
+	seq  int64
+	zipf *rand.Zipf
+}
+
+// Next generates the new values of all the placeholders.
+func (r *Renderer) Next() {
+	for i, gen := range r.t.gens {
+		r.values[i] = gen.next(r.rnd, &r.states[i])
+	}
+}
+
+// SQL returns the i-th statement with the current placeholder values.
+func (r *Renderer) SQL(i int) string {
+	var b strings.Builder
+	for _, seg := range r.t.stmts[i] {
+		if seg.gen < 0 {
+			b.WriteString(seg.text)
+			continue
+		}
+		b.WriteString(sqlLiteral(r.values[seg.gen]))
+	}
+	return b.String()
+}
+
+// PreparedSQL returns the i-th statement with `?` markers instead of the placeholders.
+func (t *Template) PreparedSQL(i int) string {
+	var b strings.Builder
+	for _, seg := range t.stmts[i] {
+		if seg.gen < 0 {
+			b.WriteString(seg.text)
+			continue
+		}
+		b.WriteString("?")
+	}
+	return b.String()
+}
+
+// Args returns the current placeholder values of the i-th statement, they
+// are the arguments of the statement returned by PreparedSQL.
+func (r *Renderer) Args(i int) []interface{} {
+	args := make([]interface{}, 0, len(r.t.stmts[i]))
+	for _, seg := range r.t.stmts[i] {
+		if seg.gen >= 0 {
+			args = append(args, r.values[seg.gen])
+		}
+	}
+	return args
+}
+
+func sqlLiteral(v interface{}) string {
+	switch x := v.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(x) + "'"
+	default:
+		return fmt.Sprintf("'%v'", x)
+	}
+}
+
+// maxStrLen is the max length of the str generator.
+const maxStrLen = 16 << 20
+
+type generator struct {
+	kind string
+	min  int64
+	max  int64
+	zipf float64
+	list []interface{}
+	// gseq is the sequence shared by all the renderers.
+	gseq *int64
+}
+
+func parseGenerator(spec string) (*generator, error) {
+	lp := strings.Index(spec, "(")
+	if lp <= 0 || !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("invalid generator: %v", spec)
+	}
+	kind := strings.ToLower(strings.TrimSpace(spec[:lp]))
+	args, err := parseArgs(spec[lp+1 : len(spec)-1])
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{kind: kind}
+	intArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			if min == max {
+				return fmt.Errorf("%v needs %v arguments", kind, min)
+			}
+			return fmt.Errorf("%v needs %v to %v arguments", kind, min, max)
+		}
+		for i, arg := range args {
+			v, ok := arg.(int64)
+			if !ok {
+				return fmt.Errorf("%v argument %v should be integer", kind, i+1)
+			}
+			switch i {
+			case 0:
+				g.min = v
+			case 1:
+				g.max = v
+			}
+		}
+		return nil
+	}
+	switch kind {
+	case "int":
+		err = intArgs(2, 2)
+	case "zipf":
+		g.zipf = 1.1
+		if len(args) == 3 {
+			s, ok := toFloat(args[2])
+			if !ok || s <= 1 {
+				return nil, fmt.Errorf("zipf skew should be a number greater than 1")
+			}
+			g.zipf = s
+			args = args[:2]
+		}
+		err = intArgs(2, 2)
+	case "str":
+		err = intArgs(1, 2)
+		if len(args) == 1 {
+			g.max = g.min
+		}
+		if err == nil && g.min < 0 {
+			err = fmt.Errorf("str length should not be negative")
+		}
+		if err == nil && g.max > maxStrLen {
+			err = fmt.Errorf("str length should not be larger than %v", maxStrLen)
+		}
+	case "date", "datetime":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%v needs 2 arguments", kind)
+		}
+		for i, arg := range args {
+			str, ok := arg.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v argument %v should be a quoted date", kind, i+1)
+			}
+			t, err := parseDate(str)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				g.min = t.Unix()
+			} else {
+				g.max = t.Unix()
+			}
+		}
+	case "pick":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("pick needs at least 1 argument")
+		}
+		g.list = args
+	case "uuid":
+		if len(args) != 0 {
+			return nil, fmt.Errorf("uuid doesn't need argument")
+		}
+	case "seq", "gseq":
+		g.min = 1
+		err = intArgs(0, 1)
+		g.gseq = new(int64)
+	default:
+		return nil, fmt.Errorf("unknown generator: %v", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.max < g.min && kind != "seq" && kind != "gseq" {
+		return nil, fmt.Errorf("%v max value should not be less than min value", kind)
+	}
+	return g, nil
+}
+
+func (g *generator) next(rnd *rand.Rand, state *genState) interface{} {
+	switch g.kind {
+	case "int":
+		return between(rnd, g.min, g.max)
+	case "zipf":
+		if state.zipf == nil {
+			state.zipf = rand.NewZipf(rnd, g.zipf, 1, uint64(g.max-g.min))
+		}
+		return g.min + int64(state.zipf.Uint64())
+	case "str":
+		n := between(rnd, g.min, g.max)
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letterBytes[rnd.Intn(len(letterBytes))]
+		}
+		return string(b)
+	case "date":
+		return time.Unix(between(rnd, g.min, g.max), 0).In(Local).Format(TimeFormatForDATE)
+	case "datetime":
+		return time.Unix(between(rnd, g.min, g.max), 0).In(Local).Format(TimeFormatForDATETIME)
+	case "pick":
+		return g.list[rnd.Intn(len(g.list))]
+	case "uuid":
+		b := make([]byte, 16)
+		rnd.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "seq":
+		v := g.min + state.seq
+		state.seq++
+		return v
+	case "gseq":
+		return g.min + atomic.AddInt64(g.gseq, 1) - 1
+	}
+	return nil
+}
+
+// between returns a uniform random integer in [min, max], the span of the
+// range may overflow int64, such as int(-9223372036854775808, 9223372036854775807).
+func between(rnd *rand.Rand, min, max int64) int64 {
+	span := uint64(max) - uint64(min)
+	if span < math.MaxInt64 {
+		return min + rnd.Int63n(int64(span)+1)
+	}
+	if span == math.MaxUint64 {
+		return int64(rnd.Uint64())
+	}
+	return int64(uint64(min) + rnd.Uint64()%(span+1))
+}
+
+// parseArgs parses the comma separated arguments, the argument is an integer,
+// a float, or a string quoted by ' or ".
+func parseArgs(s string) ([]interface{}, error) {
+	var args []interface{}
+	s = strings.TrimSpace(s)
+	for len(s) > 0 {
+		var arg interface{}
+		if s[0] == '\'' || s[0] == '"' {
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote: %v", s)
+			}
+			arg = s[1 : end+1]
+			s = strings.TrimSpace(s[end+2:])
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			str := strings.TrimSpace(s[:end])
+			if v, err := strconv.ParseInt(str, 10, 64); err == nil {
+				arg = v
+			} else if v, err := strconv.ParseFloat(str, 64); err == nil {
+				arg = v
+			} else {
+				return nil, fmt.Errorf("invalid argument: %v, string argument should be quoted", str)
+			}
+			s = s[end:]
+		}
+		args = append(args, arg)
+		if len(s) == 0 {
+			break
+		}
+		if s[0] != ',' {
+			return nil, fmt.Errorf("expect ',' before %v", s)
+		}
+		s = strings.TrimSpace(s[1:])
+		if len(s) == 0 {
+			return nil, fmt.Errorf("missing argument after ','")
+		}
+	}
+	return args, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{TimeFormatForDATETIME, TimeFormatForDATE} {
+		t, err := time.ParseInLocation(layout, s, Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %v", s)
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, rnd *rand.Rand, vars map[string]string, sqls ...string) (*Template, *Renderer) {
+	t.Helper()
+	tpl, err := ParseTemplate(vars, sqls...)
+	if err != nil {
+		t.Fatalf("parse %v: %v", sqls, err)
+	}
+	return tpl, tpl.NewRenderer(rnd)
+}
+
+func TestTemplateNamedPlaceholders(t *testing.T) {
+	// the named placeholder is generated once per Next and shared by all the statements.
+	_, r := render(t, rand.New(rand.NewSource(1)), map[string]string{"from": "int(1, 1000000)"},
+		"update account set balance = balance - 1 where id = {{from}}",
+		"update account set balance = balance + 1 where id = {{to:int(1, 1000000)}} and id != {{from}}",
+		"insert into log values ({{from}}, {{to}})",
+	)
+	for i := 0; i < 10; i++ {
+		r.Next()
+		first, second, third := r.SQL(0), r.SQL(1), r.SQL(2)
+		from := strings.TrimPrefix(first, "update account set balance = balance - 1 where id = ")
+		to := strings.TrimPrefix(strings.TrimSuffix(second, " and id != "+from), "update account set balance = balance + 1 where id = ")
+		if strings.Contains(to, " ") {
+			t.Fatalf("the statements don't share the value of from: %v; %v", first, second)
+		}
+		if third != "insert into log values ("+from+", "+to+")" {
+			t.Fatalf("the statements don't share the values: %v; %v; %v", first, second, third)
+		}
+	}
+}
+
+func TestTemplateSequences(t *testing.T) {
+	tpl, err := ParseTemplate(nil, "select {{seq(10)}}, {{gseq(100)}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// seq is of every renderer, gseq is shared by all the renderers of the template.
+	r1, r2 := tpl.NewRenderer(rand.New(rand.NewSource(1))), tpl.NewRenderer(rand.New(rand.NewSource(2)))
+	var got []string
+	for _, r := range []*Renderer{r1, r2, r1, r2} {
+		r.Next()
+		got = append(got, r.SQL(0))
+	}
+	expect := []string{"select 10, 100", "select 10, 101", "select 11, 102", "select 11, 103"}
+	if strings.Join(got, "; ") != strings.Join(expect, "; ") {
+		t.Errorf("expect %v, got %v", expect, got)
+	}
+}
+
+func TestTemplateDeterministic(t *testing.T) {
+	sql := "select {{int(1, 100)}}, {{zipf(1, 100, 1.5)}}, {{str(5, 10)}}, {{date('2020-01-01', '2020-12-31')}}, {{pick('a', 'b', 3)}}, {{uuid()}}"
+	_, r1 := render(t, rand.New(rand.NewSource(7)), nil, sql)
+	_, r2 := render(t, rand.New(rand.NewSource(7)), nil, sql)
+	for i := 0; i < 20; i++ {
+		r1.Next()
+		r2.Next()
+		if r1.SQL(0) != r2.SQL(0) {
+			t.Fatalf("the same seed renders different statements: %v and %v", r1.SQL(0), r2.SQL(0))
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	_, r := render(t, rand.New(rand.NewSource(1)), map[string]string{"name": `pick("it's a\b")`, "score": "pick(1.5)"},
+		"insert into t values ({{name}}, {{score}}, {{int(-3, -3)}})")
+	r.Next()
+	if sql := r.SQL(0); sql != `insert into t values ('it\'s a\\b', 1.5, -3)` {
+		t.Errorf("unexpected literals: %v", sql)
+	}
+}
+
+func TestGeneratorRanges(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	t.Run("int", func(t *testing.T) {
+		g, _ := parseGenerator("int(-5, 5)")
+		seen := make(map[int64]bool)
+		for i := 0; i < 1000; i++ {
+			v := g.next(rnd, &genState{}).(int64)
+			if v < -5 || v > 5 {
+				t.Fatalf("%v is out of [-5, 5]", v)
+			}
+			seen[v] = true
+		}
+		if len(seen) != 11 {
+			t.Errorf("expect all the 11 values, got %v", len(seen))
+		}
+	})
+	t.Run("int64 range", func(t *testing.T) {
+		// the spans of these ranges overflow int64.
+		for spec, bounds := range map[string][2]int64{
+			"int(-9223372036854775808, 9223372036854775807)":     {math.MinInt64, math.MaxInt64},
+			"int(-1, 9223372036854775807)":                       {-1, math.MaxInt64},
+			"int(-9223372036854775808, 1)":                       {math.MinInt64, 1},
+			"zipf(-9223372036854775808, 9223372036854775807, 2)": {math.MinInt64, math.MaxInt64},
+		} {
+			g, err := parseGenerator(spec)
+			if err != nil {
+				t.Fatalf("%v: %v", spec, err)
+			}
+			var state genState
+			negative := 0
+			for i := 0; i < 1000; i++ {
+				v := g.next(rnd, &state).(int64)
+				if v < bounds[0] || v > bounds[1] {
+					t.Fatalf("%v: %v is out of [%v, %v]", spec, v, bounds[0], bounds[1])
+				}
+				if v < 0 {
+					negative++
+				}
+			}
+			// the full range is uniform, and the zipf values are near min.
+			if strings.HasPrefix(spec, "int(-9223372036854775808, 9") && (negative < 400 || negative > 600) {
+				t.Errorf("%v: %v of 1000 values are negative", spec, negative)
+			}
+		}
+	})
+	t.Run("zipf", func(t *testing.T) {
+		g, _ := parseGenerator("zipf(10, 19, 2)")
+		var state genState
+		counts := make(map[int64]int)
+		for i := 0; i < 1000; i++ {
+			v := g.next(rnd, &state).(int64)
+			if v < 10 || v > 19 {
+				t.Fatalf("%v is out of [10, 19]", v)
+			}
+			counts[v]++
+		}
+		if counts[10] < counts[11] || counts[11] < counts[15] {
+			t.Errorf("zipf should prefer the small values: %v", counts)
+		}
+	})
+	t.Run("str", func(t *testing.T) {
+		g, _ := parseGenerator("str(2, 4)")
+		for i := 0; i < 100; i++ {
+			if s := g.next(rnd, &genState{}).(string); len(s) < 2 || len(s) > 4 {
+				t.Fatalf("unexpected length of %q", s)
+			}
+		}
+	})
+	t.Run("datetime", func(t *testing.T) {
+		g, _ := parseGenerator("datetime('2020-01-01 00:00:00', '2020-01-01 23:59:59')")
+		for i := 0; i < 100; i++ {
+			if s := g.next(rnd, &genState{}).(string); !strings.HasPrefix(s, "2020-01-01 ") {
+				t.Fatalf("unexpected datetime %v", s)
+			}
+		}
+	})
+	t.Run("uuid", func(t *testing.T) {
+		g, _ := parseGenerator("uuid()")
+		if s := g.next(rnd, &genState{}).(string); len(s) != 36 || s[14] != '4' {
+			t.Errorf("unexpected uuid %v", s)
+		}
+	})
+}
+
+func TestTemplateErrors(t *testing.T) {
+	for sql, msg := range map[string]string{
+		"select {{id}}": "unknown placeholder",
+		"select {{id:int(1, 2)}}, {{id:int(1, 2)}}":   "duplicate placeholder",
+		"select {{int(1, 2)":                          "unclosed placeholder",
+		"select {{int(1)}}":                           "int needs 2 arguments",
+		"select {{int(10, 1)}}":                       "max value should not be less than min value",
+		"select {{zipf(1, 10, 1)}}":                   "greater than 1",
+		"select {{date('2020-13-01', '2020-12-31')}}": "invalid date",
+		"select {{pick()}}":                           "at least 1 argument",
+		"select {{str(1, 16777217)}}":                 "should not be larger than",
+		"select {{foo(1)}}":                           "unknown generator",
+		"select {{pick(abc)}}":                        "should be quoted",
+	} {
+		if _, err := ParseTemplate(nil, sql); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%v: expect error %q, got %v", sql, msg, err)
+		}
+	}
+}
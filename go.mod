@@ -3,6 +3,9 @@ module github.com/crazycs520/testutil
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v1.2.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v2 v2.4.0
 )
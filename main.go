@@ -1,15 +1,25 @@
 package main
 
 import (
+	"errors"
 	"github.com/crazycs520/testutil/cmd"
 	_ "github.com/crazycs520/testutil/test_case"
 	"log"
+	"os"
 )
 
+// The exit code is 1 if the command meets an error, and 2 if any assertion of the run failed.
+const exitAssertionFailed = 2
+
 func main() {
 	app := cmd.NewApp()
-	err := app.Cmd().Execute()
+	err := app.Execute()
 	if err != nil {
+		var assertErr *cmd.AssertionError
+		if errors.As(err, &assertErr) {
+			log.Println(err)
+			os.Exit(exitAssertionFailed)
+		}
 		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// The histogram uses HDR-style log-linear buckets: values below subBucketCount
+// are recorded exactly, larger values are recorded with a relative error
+// below 1/subBucketHalfCount (about 1.6%).
+const (
+	subBucketBits      = 7
+	subBucketCount     = 1 << subBucketBits
+	subBucketHalfCount = subBucketCount / 2
+	bucketNum          = 64 - subBucketBits
+	countsLen          = subBucketCount + bucketNum*subBucketHalfCount
+)
+
+// Histogram records latencies in nanoseconds. It is not safe for concurrent use.
+type Histogram struct {
+	counts [countsLen]int64
+	total  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func NewHistogram() *Histogram {
+	h := &Histogram{}
+	h.Reset()
+	return h
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	h.counts[countsIndex(v)]++
+	h.total++
+	h.sum += v
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *Histogram) Merge(o *Histogram) {
+	if o.total == 0 {
+		return
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.sum += o.sum
+	if o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+func (h *Histogram) Reset() {
+	h.counts = [countsLen]int64{}
+	h.total = 0
+	h.sum = 0
+	h.min = math.MaxInt64
+	h.max = 0
+}
+
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+func (h *Histogram) Min() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max)
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / h.total)
+}
+
+// ValueAtPercentile returns the highest value which is equivalent (within the
+// bucket precision) to the value at the given percentile, such as 99 or 99.9.
+func (h *Histogram) ValueAtPercentile(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	if p > 100 {
+		p = 100
+	}
+	// multiply before dividing, p/100 is inexact and 99.9/100*1000 is a bit more than 999.
+	target := int64(math.Ceil(p * float64(h.total) / 100))
+	if target < 1 {
+		target = 1
+	}
+	var cnt int64
+	for i, c := range h.counts {
+		cnt += c
+		if cnt >= target {
+			v := highestEquivalentValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+func countsIndex(v int64) int {
+	bucket := bits.Len64(uint64(v)) - subBucketBits
+	if bucket <= 0 {
+		return int(v)
+	}
+	sub := int(v >> uint(bucket))
+	return subBucketCount + (bucket-1)*subBucketHalfCount + sub - subBucketHalfCount
+}
+
+func highestEquivalentValue(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	idx -= subBucketCount
+	bucket := uint(idx/subBucketHalfCount + 1)
+	sub := int64(idx%subBucketHalfCount + subBucketHalfCount)
+	high := (sub+1)<<bucket - 1
+	if high < 0 {
+		return math.MaxInt64
+	}
+	return high
+}
@@ -0,0 +1,152 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func record(values ...time.Duration) *Histogram {
+	h := NewHistogram()
+	for _, v := range values {
+		h.Record(v)
+	}
+	return h
+}
+
+// checkPercentile checks the value at the percentile is want, or a higher
+// value in the same bucket, which is below want*(1+1/subBucketHalfCount).
+func checkPercentile(t *testing.T, h *Histogram, p float64, want time.Duration) {
+	t.Helper()
+	got := h.ValueAtPercentile(p)
+	if got < want || got-want > want/subBucketHalfCount {
+		t.Errorf("p%v: expect %v, got %v", p, want, got)
+	}
+}
+
+func TestBucketBoundaries(t *testing.T) {
+	// the values below subBucketCount are exact, then every bucket doubles the width of the sub buckets.
+	for v := int64(0); v < subBucketCount; v++ {
+		if idx := countsIndex(v); idx != int(v) || highestEquivalentValue(idx) != v {
+			t.Fatalf("%v: index %v, highest equivalent value %v", v, idx, highestEquivalentValue(idx))
+		}
+	}
+	if countsIndex(128) != countsIndex(129) || countsIndex(129) == countsIndex(130) {
+		t.Errorf("128 and 129 should share a bucket of width 2, 130 starts the next")
+	}
+	if countsIndex(256) != countsIndex(259) || countsIndex(259) == countsIndex(260) {
+		t.Errorf("256 to 259 should share a bucket of width 4, 260 starts the next")
+	}
+	if idx := countsIndex(math.MaxInt64); idx >= countsLen || highestEquivalentValue(idx) != math.MaxInt64 {
+		t.Errorf("max int64: index %v of %v, highest equivalent value %v", idx, countsLen, highestEquivalentValue(idx))
+	}
+	// every bucket ends right before the next one starts, and keeps the relative error.
+	for idx := 0; idx < countsLen-1; idx++ {
+		high := highestEquivalentValue(idx)
+		if high == math.MaxInt64 {
+			break
+		}
+		if countsIndex(high) != idx || countsIndex(high+1) != idx+1 {
+			t.Fatalf("bucket %v ends at %v, which is in bucket %v, the next value is in bucket %v", idx, high, countsIndex(high), countsIndex(high+1))
+		}
+		low := int64(0)
+		if idx > 0 {
+			low = highestEquivalentValue(idx-1) + 1
+		}
+		if high-low > low/subBucketHalfCount {
+			t.Fatalf("bucket %v of [%v, %v] is wider than the precision", idx, low, high)
+		}
+	}
+}
+
+func TestPercentileAtBucketBoundaries(t *testing.T) {
+	// 127 is the last exact value, 128 starts the bucket of [128, 129].
+	h := record(127, 128)
+	if h.ValueAtPercentile(50) != 127 || h.ValueAtPercentile(100) != 128 {
+		t.Errorf("127, 128: p50 %v, p100 %v", h.ValueAtPercentile(50), h.ValueAtPercentile(100))
+	}
+	// the values of a bucket report the highest value of the bucket, but not above the max.
+	h = record(128, 129, 130)
+	if h.ValueAtPercentile(33) != 129 || h.ValueAtPercentile(66) != 129 || h.ValueAtPercentile(67) != 130 {
+		t.Errorf("128, 129, 130: p33 %v, p66 %v, p67 %v", h.ValueAtPercentile(33), h.ValueAtPercentile(66), h.ValueAtPercentile(67))
+	}
+	// and not below the min.
+	h = record(1000, 1001)
+	if h.ValueAtPercentile(0) != 1001 || h.Min() != 1000 {
+		t.Errorf("1000, 1001: p0 %v, min %v", h.ValueAtPercentile(0), h.Min())
+	}
+	// a percentile between two ranks takes the higher rank.
+	h = NewHistogram()
+	for i := 0; i < 999; i++ {
+		h.Record(time.Millisecond)
+	}
+	h.Record(time.Second)
+	checkPercentile(t, h, 99.9, time.Millisecond)
+	checkPercentile(t, h, 99.91, time.Second)
+	if h.ValueAtPercentile(100) != time.Second || h.ValueAtPercentile(1000) != time.Second {
+		t.Errorf("p100 %v, p1000 %v", h.ValueAtPercentile(100), h.ValueAtPercentile(1000))
+	}
+}
+
+func TestUniformDistribution(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	if h.Count() != 10000 || h.Min() != time.Microsecond || h.Max() != 10*time.Millisecond || h.Mean() != 5000500*time.Nanosecond {
+		t.Fatalf("count %v, min %v, max %v, mean %v", h.Count(), h.Min(), h.Max(), h.Mean())
+	}
+	checkPercentile(t, h, 50, 5*time.Millisecond)
+	checkPercentile(t, h, 90, 9*time.Millisecond)
+	checkPercentile(t, h, 99, 9900*time.Microsecond)
+	checkPercentile(t, h, 99.9, 9990*time.Microsecond)
+}
+
+func TestBoundaryValues(t *testing.T) {
+	empty := NewHistogram()
+	if empty.Count() != 0 || empty.Min() != 0 || empty.Max() != 0 || empty.Mean() != 0 || empty.ValueAtPercentile(50) != 0 {
+		t.Errorf("empty: count %v, min %v, max %v, mean %v, p50 %v", empty.Count(), empty.Min(), empty.Max(), empty.Mean(), empty.ValueAtPercentile(50))
+	}
+	// the negative latency of a clock step is recorded as 0.
+	if h := record(-time.Second); h.Min() != 0 || h.Max() != 0 || h.ValueAtPercentile(99) != 0 {
+		t.Errorf("negative: min %v, max %v, p99 %v", h.Min(), h.Max(), h.ValueAtPercentile(99))
+	}
+	if h := record(1); h.ValueAtPercentile(50) != 1 || h.Mean() != 1 {
+		t.Errorf("1ns: p50 %v, mean %v", h.ValueAtPercentile(50), h.Mean())
+	}
+	if h := record(math.MaxInt64); h.ValueAtPercentile(99) != math.MaxInt64 || h.Max() != math.MaxInt64 {
+		t.Errorf("max int64: p99 %v, max %v", h.ValueAtPercentile(99), h.Max())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// the values around the bucket boundaries are split into two histograms.
+	var values []time.Duration
+	for _, base := range []int64{subBucketCount, 256, 1 << 20, 1 << 30} {
+		for d := int64(-3); d <= 3; d++ {
+			values = append(values, time.Duration(base+d))
+		}
+	}
+	whole, a, b := record(values...), record(values[:len(values)/2]...), record(values[len(values)/2:]...)
+	merged := NewHistogram()
+	merged.Merge(NewHistogram())
+	if merged.Count() != 0 || merged.Min() != 0 {
+		t.Fatalf("merging an empty histogram: count %v, min %v", merged.Count(), merged.Min())
+	}
+	merged.Merge(b)
+	merged.Merge(a)
+	if *merged != *whole {
+		t.Fatalf("merged histogram differs: count %v, min %v, max %v, expect count %v, min %v, max %v",
+			merged.Count(), merged.Min(), merged.Max(), whole.Count(), whole.Min(), whole.Max())
+	}
+	for _, p := range []float64{1, 25, 50, 75, 99, 100} {
+		if merged.ValueAtPercentile(p) != whole.ValueAtPercentile(p) {
+			t.Errorf("p%v: merged %v, whole %v", p, merged.ValueAtPercentile(p), whole.ValueAtPercentile(p))
+		}
+	}
+
+	merged.Reset()
+	if *merged != *NewHistogram() {
+		t.Errorf("the reset histogram should be empty")
+	}
+}
@@ -0,0 +1,225 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Recorder collects the latency of every executed statement, both for the
+// current report interval and for the whole run. It is safe for concurrent use.
+type Recorder struct {
+	mu            sync.Mutex
+	name          string
+	start         time.Time
+	intervalStart time.Time
+	interval      *Histogram
+	total         *Histogram
+	// errors is the error count of every error class.
+	errors         map[string]int64
+	intervalErrors map[string]int64
+	// subs are the recorders of the breakdown, such as the stats of every statement.
+	subs     map[string]*Recorder
+	subNames []string
+	// service is the service time of the open-loop run, it excludes the
+	// queueing delay which is included in the latency recorded by r.
+	service *Recorder
+}
+
+func NewRecorder() *Recorder {
+	now := time.Now()
+	return &Recorder{
+		start:          now,
+		intervalStart:  now,
+		interval:       NewHistogram(),
+		total:          NewHistogram(),
+		errors:         make(map[string]int64),
+		intervalErrors: make(map[string]int64),
+	}
+}
+
+func (r *Recorder) Record(d time.Duration) {
+	r.mu.Lock()
+	r.interval.Record(d)
+	r.total.Record(d)
+	r.mu.Unlock()
+}
+
+// RecordLatency records the latency since the intended start time, and the
+// service time since the statement was actually sent.
+func (r *Recorder) RecordLatency(latency, service time.Duration) {
+	r.mu.Lock()
+	r.interval.Record(latency)
+	r.total.Record(latency)
+	if r.service == nil {
+		r.service = NewRecorder()
+		r.service.start = r.start
+		r.service.intervalStart = r.intervalStart
+	}
+	svc := r.service
+	r.mu.Unlock()
+	svc.Record(service)
+}
+
+// Sub returns the recorder of the breakdown with the name, it is created
+// if not exists. The records of the sub recorder are not counted in r.
+func (r *Recorder) Sub(name string) *Recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sub, ok := r.subs[name]; ok {
+		return sub
+	}
+	sub := NewRecorder()
+	sub.name = name
+	sub.start = r.start
+	sub.intervalStart = r.intervalStart
+	if r.subs == nil {
+		r.subs = make(map[string]*Recorder)
+	}
+	r.subs[name] = sub
+	r.subNames = append(r.subNames, name)
+	return sub
+}
+
+func (r *Recorder) getSubs() []*Recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subs := make([]*Recorder, 0, len(r.subNames))
+	for _, name := range r.subNames {
+		subs = append(subs, r.subs[name])
+	}
+	return subs
+}
+
+// RecordError counts an error of the class.
+func (r *Recorder) RecordError(class string) {
+	r.mu.Lock()
+	r.errors[class]++
+	r.intervalErrors[class]++
+	r.mu.Unlock()
+}
+
+// ErrorCount returns the error count of the class in the whole run.
+func (r *Recorder) ErrorCount(class string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errors[class]
+}
+
+// TakeInterval returns the summary since the last call and starts a new interval.
+func (r *Recorder) TakeInterval() Summary {
+	s := r.takeInterval()
+	for _, sub := range r.getSubs() {
+		ss := sub.TakeInterval()
+		s.Subs = append(s.Subs, ss)
+	}
+	return s
+}
+
+func (r *Recorder) takeInterval() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	s := newSummary(r.interval, now.Sub(r.intervalStart))
+	s.Name = r.name
+	s.Errors = r.intervalErrors
+	r.intervalErrors = make(map[string]int64)
+	r.interval.Reset()
+	r.intervalStart = now
+	if r.service != nil {
+		svc := r.service.takeInterval()
+		s.Service = &svc
+	}
+	return s
+}
+
+// Summary returns the summary of the whole run.
+func (r *Recorder) Summary() Summary {
+	s := r.summary()
+	for _, sub := range r.getSubs() {
+		s.Subs = append(s.Subs, sub.Summary())
+	}
+	return s
+}
+
+func (r *Recorder) summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := newSummary(r.total, time.Since(r.start))
+	s.Name = r.name
+	s.Errors = make(map[string]int64, len(r.errors))
+	for k, v := range r.errors {
+		s.Errors[k] = v
+	}
+	if r.service != nil {
+		svc := r.service.summary()
+		s.Service = &svc
+	}
+	return s
+}
+
+// Elapsed returns the duration since the recorder was created.
+func (r *Recorder) Elapsed() time.Duration {
+	return time.Since(r.start)
+}
+
+// Summary is the throughput and latency distribution of a period.
+type Summary struct {
+	// Name is the name of the breakdown, it is empty for the whole run.
+	Name    string
+	Elapsed time.Duration
+	Count   int64
+	QPS     float64
+	Avg     time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P95     time.Duration
+	P99     time.Duration
+	P999    time.Duration
+	Max     time.Duration
+	Errors  map[string]int64
+	// Subs are the summaries of the breakdowns.
+	Subs []Summary
+	// Service is the service time of the open-loop run, the latency of the
+	// summary includes the queueing delay then. It is nil in the closed-loop run.
+	Service *Summary
+}
+
+func newSummary(h *Histogram, elapsed time.Duration) Summary {
+	s := Summary{
+		Elapsed: elapsed,
+		Count:   h.Count(),
+		Avg:     h.Mean(),
+		P50:     h.ValueAtPercentile(50),
+		P90:     h.ValueAtPercentile(90),
+		P95:     h.ValueAtPercentile(95),
+		P99:     h.ValueAtPercentile(99),
+		P999:    h.ValueAtPercentile(99.9),
+		Max:     h.Max(),
+	}
+	if elapsed > 0 {
+		s.QPS = float64(s.Count) / elapsed.Seconds()
+	}
+	return s
+}
+
+func (s Summary) String() string {
+	str := fmt.Sprintf("qps: %.1f, count: %v, avg: %v, p50: %v, p90: %v, p95: %v, p99: %v, p999: %v, max: %v",
+		s.QPS, s.Count, fmtDuration(s.Avg), fmtDuration(s.P50), fmtDuration(s.P90), fmtDuration(s.P95),
+		fmtDuration(s.P99), fmtDuration(s.P999), fmtDuration(s.Max))
+	if len(s.Errors) > 0 {
+		str += ", errors: " + joinCounts(s.Errors)
+	}
+	return str
+}
+
+func fmtDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
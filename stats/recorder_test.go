@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorderInterval(t *testing.T) {
+	r := NewRecorder()
+	for i := 1; i <= 100; i++ {
+		r.Record(time.Duration(i) * time.Millisecond)
+	}
+	s := r.TakeInterval()
+	if s.Count != 100 || s.Max != 100*time.Millisecond || s.P50 < 50*time.Millisecond || s.P50 > 51*time.Millisecond {
+		t.Errorf("first interval: count %v, max %v, p50 %v", s.Count, s.Max, s.P50)
+	}
+
+	r.Record(time.Second)
+	s = r.TakeInterval()
+	if s.Count != 1 || s.Max != time.Second || s.P50 != time.Second {
+		t.Errorf("second interval: count %v, max %v, p50 %v", s.Count, s.Max, s.P50)
+	}
+	if s = r.TakeInterval(); s.Count != 0 || s.QPS != 0 {
+		t.Errorf("empty interval: count %v, qps %v", s.Count, s.QPS)
+	}
+
+	// the summary covers all the intervals.
+	s = r.Summary()
+	if s.Count != 101 || s.Max != time.Second || s.Avg != (5050*time.Millisecond+time.Second)/101 {
+		t.Errorf("summary: count %v, max %v, avg %v", s.Count, s.Max, s.Avg)
+	}
+	if s.Elapsed <= 0 || s.QPS != float64(s.Count)/s.Elapsed.Seconds() {
+		t.Errorf("summary: elapsed %v, qps %v", s.Elapsed, s.QPS)
+	}
+}
+
+func TestRecorderSubs(t *testing.T) {
+	r := NewRecorder()
+	get, update := r.Sub("get"), r.Sub("update")
+	if r.Sub("get") != get {
+		t.Fatalf("the sub recorder of the same name should be reused")
+	}
+	for i := 0; i < 3; i++ {
+		get.Record(time.Millisecond)
+	}
+	update.Record(10 * time.Millisecond)
+	r.Record(2 * time.Millisecond)
+
+	// the breakdowns keep the creation order and are not counted in the parent.
+	s := r.TakeInterval()
+	if s.Count != 1 || len(s.Subs) != 2 {
+		t.Fatalf("interval: count %v, subs %v", s.Count, len(s.Subs))
+	}
+	if s.Subs[0].Name != "get" || s.Subs[0].Count != 3 || s.Subs[1].Name != "update" || s.Subs[1].Max != 10*time.Millisecond {
+		t.Errorf("interval subs: %+v", s.Subs)
+	}
+	// the intervals of the breakdowns are reset with the parent.
+	get.Record(time.Millisecond)
+	s = r.TakeInterval()
+	if s.Subs[0].Count != 1 || s.Subs[1].Count != 0 {
+		t.Errorf("second interval: get %v, update %v", s.Subs[0].Count, s.Subs[1].Count)
+	}
+	s = r.Summary()
+	if s.Count != 1 || s.Subs[0].Count != 4 || s.Subs[1].Count != 1 {
+		t.Errorf("summary: count %v, get %v, update %v", s.Count, s.Subs[0].Count, s.Subs[1].Count)
+	}
+}
+
+func TestRecorderServiceTime(t *testing.T) {
+	r := NewRecorder()
+	r.Record(time.Millisecond)
+	if s := r.Summary(); s.Service != nil {
+		t.Fatalf("the closed-loop summary should not have the service time")
+	}
+	// the latency includes the queueing delay, the service time doesn't.
+	r = NewRecorder()
+	r.RecordLatency(30*time.Millisecond, 10*time.Millisecond)
+	r.RecordLatency(50*time.Millisecond, 20*time.Millisecond)
+	s := r.TakeInterval()
+	if s.Count != 2 || s.Avg != 40*time.Millisecond || s.Service == nil || s.Service.Count != 2 || s.Service.Avg != 15*time.Millisecond {
+		t.Fatalf("interval: count %v, avg %v, service %+v", s.Count, s.Avg, s.Service)
+	}
+	r.RecordLatency(time.Second, time.Millisecond)
+	if s = r.TakeInterval(); s.Service.Count != 1 || s.Service.Max != time.Millisecond {
+		t.Errorf("second interval service: %+v", s.Service)
+	}
+	if s = r.Summary(); s.Max != time.Second || s.Service.Count != 3 || s.Service.Max != 20*time.Millisecond {
+		t.Errorf("summary: max %v, service %+v", s.Max, s.Service)
+	}
+}
@@ -0,0 +1,402 @@
+package stats
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Sink receives the per-interval samples, the per-step summaries of the ramp
+// run and the final summary of a run.
+type Sink interface {
+	Interval(s Summary) error
+	Step(s Step) error
+	Final(r Result) error
+}
+
+// Step is the summary of a concurrency step of the ramp run.
+type Step struct {
+	Concurrency int
+	Summary     Summary
+}
+
+// Result is the final record of a run.
+type Result struct {
+	Command string
+	Params  map[string]string
+	Summary Summary
+	// MaxStep is the step with the max throughput found by the find-max run.
+	MaxStep *Step
+	// Assertions are the results of the assertions checked after the run.
+	Assertions []Assertion
+	Err        error
+}
+
+// Assertion is the result of an assertion, Actual is the value of the metric or the query.
+type Assertion struct {
+	Expr   string `json:"expr"`
+	Actual string `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// NewSink creates a sink which writes to w in the format.
+func NewSink(format string, w io.Writer) (Sink, error) {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return &textSink{w: w}, nil
+	case FormatJSON:
+		return &jsonSink{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvSink{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %v, should be one of %v, %v, %v", format, FormatText, FormatJSON, FormatCSV)
+}
+
+// MultiSink duplicates the output to all the sinks.
+type MultiSink []Sink
+
+func (m MultiSink) Interval(s Summary) error {
+	for _, sink := range m {
+		if err := sink.Interval(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) Step(s Step) error {
+	for _, sink := range m {
+		if err := sink.Step(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MultiSink) Final(r Result) error {
+	for _, sink := range m {
+		if err := sink.Final(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type textSink struct {
+	w io.Writer
+}
+
+func (t *textSink) Interval(s Summary) error {
+	return t.write(fmt.Sprintf("[%v]", s.Elapsed.Round(time.Second)), s)
+}
+
+func (t *textSink) Step(s Step) error {
+	return t.write(fmt.Sprintf("[step concurrency=%v]", s.Concurrency), s.Summary)
+}
+
+func (t *textSink) Final(r Result) error {
+	if r.MaxStep != nil {
+		if err := t.write(fmt.Sprintf("[max concurrency=%v]", r.MaxStep.Concurrency), r.MaxStep.Summary); err != nil {
+			return err
+		}
+	}
+	if err := t.write("[summary]", r.Summary); err != nil {
+		return err
+	}
+	for _, a := range r.Assertions {
+		result := "passed"
+		if !a.Passed {
+			result = "FAILED"
+		}
+		if _, err := fmt.Fprintf(t.w, "[assert] %v: %v, actual: %v\n", result, a.Expr, a.Actual); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *textSink) write(prefix string, s Summary) error {
+	if _, err := fmt.Fprintf(t.w, "%v %v\n", prefix, s); err != nil {
+		return err
+	}
+	if s.Service != nil {
+		if _, err := fmt.Fprintf(t.w, "%v    service time - %v\n", prefix, *s.Service); err != nil {
+			return err
+		}
+	}
+	for _, sub := range s.Subs {
+		if _, err := fmt.Fprintf(t.w, "%v    %v - %v\n", prefix, sub.Name, sub); err != nil {
+			return err
+		}
+		if sub.Service != nil {
+			if _, err := fmt.Fprintf(t.w, "%v    %v service time - %v\n", prefix, sub.Name, *sub.Service); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type jsonSink struct {
+	enc *json.Encoder
+}
+
+type jsonRecord struct {
+	Type    string            `json:"type"`
+	Name    string            `json:"name,omitempty"`
+	Time    string            `json:"time"`
+	Command string            `json:"command,omitempty"`
+	Params  map[string]string `json:"params,omitempty"`
+	// Concurrency is the worker count of the step.
+	Concurrency int     `json:"concurrency,omitempty"`
+	Elapsed     float64 `json:"elapsed_s"`
+	Count       int64   `json:"count"`
+	QPS         float64 `json:"qps"`
+	jsonLatency
+	// Service is the service time of the open-loop run.
+	Service *jsonLatency     `json:"service,omitempty"`
+	Errors  map[string]int64 `json:"errors,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	// Assertions are the assertion results of the final summary.
+	Assertions []Assertion `json:"assertions,omitempty"`
+}
+
+type jsonLatency struct {
+	AvgMs  float64 `json:"avg_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+func newJSONLatency(s Summary) jsonLatency {
+	return jsonLatency{
+		AvgMs:  ms(s.Avg),
+		P50Ms:  ms(s.P50),
+		P90Ms:  ms(s.P90),
+		P95Ms:  ms(s.P95),
+		P99Ms:  ms(s.P99),
+		P999Ms: ms(s.P999),
+		MaxMs:  ms(s.Max),
+	}
+}
+
+func newJSONRecord(tp string, s Summary) *jsonRecord {
+	rec := &jsonRecord{
+		Type:        tp,
+		Name:        s.Name,
+		Time:        time.Now().Format(time.RFC3339Nano),
+		Elapsed:     s.Elapsed.Seconds(),
+		Count:       s.Count,
+		QPS:         s.QPS,
+		jsonLatency: newJSONLatency(s),
+		Errors:      s.Errors,
+	}
+	if s.Service != nil {
+		svc := newJSONLatency(*s.Service)
+		rec.Service = &svc
+	}
+	return rec
+}
+
+func (j *jsonSink) Interval(s Summary) error {
+	for _, sub := range s.Subs {
+		if err := j.enc.Encode(newJSONRecord("interval", sub)); err != nil {
+			return err
+		}
+	}
+	return j.enc.Encode(newJSONRecord("interval", s))
+}
+
+func (j *jsonSink) Step(s Step) error {
+	return j.writeStep("step", s)
+}
+
+func (j *jsonSink) writeStep(tp string, s Step) error {
+	for _, sub := range s.Summary.Subs {
+		rec := newJSONRecord(tp, sub)
+		rec.Concurrency = s.Concurrency
+		if err := j.enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	rec := newJSONRecord(tp, s.Summary)
+	rec.Concurrency = s.Concurrency
+	return j.enc.Encode(rec)
+}
+
+func (j *jsonSink) Final(r Result) error {
+	if r.MaxStep != nil {
+		if err := j.writeStep("max", *r.MaxStep); err != nil {
+			return err
+		}
+	}
+	for _, sub := range r.Summary.Subs {
+		if err := j.enc.Encode(newJSONRecord("summary", sub)); err != nil {
+			return err
+		}
+	}
+	rec := newJSONRecord("summary", r.Summary)
+	rec.Command = r.Command
+	rec.Params = r.Params
+	rec.Assertions = r.Assertions
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return j.enc.Encode(rec)
+}
+
+var csvHeader = []string{"type", "name", "time", "elapsed_s", "count", "qps", "avg_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms", "p999_ms", "max_ms", "errors", "command", "params", "error",
+	"service_avg_ms", "service_p50_ms", "service_p90_ms", "service_p95_ms", "service_p99_ms", "service_p999_ms", "service_max_ms",
+	"concurrency"}
+
+type csvSink struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvSink) write(tp string, s Summary, r *Result) error {
+	return c.writeRow(tp, s, r, 0)
+}
+
+func (c *csvSink) writeRow(tp string, s Summary, r *Result, concurrency int) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	row := []string{
+		tp,
+		s.Name,
+		time.Now().Format(time.RFC3339Nano),
+		formatFloat(s.Elapsed.Seconds()),
+		strconv.FormatInt(s.Count, 10),
+		formatFloat(s.QPS),
+		formatFloat(ms(s.Avg)),
+		formatFloat(ms(s.P50)),
+		formatFloat(ms(s.P90)),
+		formatFloat(ms(s.P95)),
+		formatFloat(ms(s.P99)),
+		formatFloat(ms(s.P999)),
+		formatFloat(ms(s.Max)),
+		joinCounts(s.Errors),
+		"", "", "",
+	}
+	if svc := s.Service; svc != nil {
+		row = append(row, formatFloat(ms(svc.Avg)), formatFloat(ms(svc.P50)), formatFloat(ms(svc.P90)),
+			formatFloat(ms(svc.P95)), formatFloat(ms(svc.P99)), formatFloat(ms(svc.P999)), formatFloat(ms(svc.Max)))
+	} else {
+		row = append(row, "", "", "", "", "", "", "")
+	}
+	if concurrency > 0 {
+		row = append(row, strconv.Itoa(concurrency))
+	} else {
+		row = append(row, "")
+	}
+	if r != nil {
+		row[14] = r.Command
+		row[15] = joinParams(r.Params)
+		if r.Err != nil {
+			row[16] = r.Err.Error()
+		}
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvSink) Interval(s Summary) error {
+	for _, sub := range s.Subs {
+		if err := c.write("interval", sub, nil); err != nil {
+			return err
+		}
+	}
+	return c.write("interval", s, nil)
+}
+
+func (c *csvSink) Step(s Step) error {
+	return c.writeStep("step", s)
+}
+
+func (c *csvSink) writeStep(tp string, s Step) error {
+	for _, sub := range s.Summary.Subs {
+		if err := c.writeRow(tp, sub, nil, s.Concurrency); err != nil {
+			return err
+		}
+	}
+	return c.writeRow(tp, s.Summary, nil, s.Concurrency)
+}
+
+func (c *csvSink) Final(r Result) error {
+	if r.MaxStep != nil {
+		if err := c.writeStep("max", *r.MaxStep); err != nil {
+			return err
+		}
+	}
+	for _, sub := range r.Summary.Subs {
+		if err := c.write("summary", sub, nil); err != nil {
+			return err
+		}
+	}
+	if err := c.write("summary", r.Summary, &r); err != nil {
+		return err
+	}
+	for _, a := range r.Assertions {
+		// the assertion row only has the expression, and the actual value in the error column if it failed.
+		row := make([]string, len(csvHeader))
+		row[0], row[1], row[2] = "assertion", a.Expr, time.Now().Format(time.RFC3339Nano)
+		if !a.Passed {
+			row[16] = "assertion failed, actual: " + a.Actual
+		}
+		if err := c.w.Write(row); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func joinCounts(m map[string]int64) string {
+	items := make(map[string]string, len(m))
+	for k, v := range m {
+		items[k] = strconv.FormatInt(v, 10)
+	}
+	return joinParams(items)
+}
+
+func joinParams(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, k+"="+m[k])
+	}
+	return strings.Join(items, ";")
+}
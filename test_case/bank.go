@@ -0,0 +1,283 @@
+package test_case
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/cmd"
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/util"
+	"github.com/spf13/cobra"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	txnModeOptimistic  = "optimistic"
+	txnModePessimistic = "pessimistic"
+	txnModeMixed       = "mixed"
+)
+
+// maxTransferAmount is the max amount of one transfer.
+const maxTransferAmount = 10
+
+// Bank transfers the money between the accounts concurrently, and checks the
+// total balance of the accounts never changes with snapshot reads.
+type Bank struct {
+	cmd.BaseCase
+	cfg *config.Config
+
+	accounts      int
+	balance       int64
+	txnMode       string
+	isolation     string
+	interval      int64
+	checkInterval time.Duration
+
+	transfers int64
+	checks    int64
+
+	mu         sync.Mutex
+	violations []bankViolation
+}
+
+// bankViolation is a check whose total balance is not the expected.
+type bankViolation struct {
+	time time.Time
+	// ts is the start ts of the snapshot, it is empty if the database is not TiDB.
+	ts       string
+	accounts int
+	total    int64
+}
+
+func NewBank(cfg *config.Config) cmd.Case {
+	return &Bank{
+		cfg: cfg,
+	}
+}
+
+func (c *Bank) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "bank",
+		Short:        "test the total balance of the accounts doesn't change by the concurrent transfers",
+		Long:         `transfer the money between the accounts concurrently, and check the total balance of the accounts with snapshot reads`,
+		SilenceUsage: true,
+	}
+	cmd.Flags().IntVarP(&c.accounts, "accounts", "", 100, "the number of the accounts")
+	cmd.Flags().Int64VarP(&c.balance, "balance", "", 1000, "the initial balance of every account")
+	cmd.Flags().StringVarP(&c.txnMode, "txn-mode", "", txnModeMixed, "the transaction mode of the transfers, one of optimistic, pessimistic and mixed")
+	cmd.Flags().StringVarP(&c.isolation, "isolation", "", "", "the isolation level of the transfers, such as repeatable-read and read-committed, default is the isolation of the server")
+	cmd.Flags().Int64VarP(&c.interval, "interval", "", 1, "print message interval seconds")
+	cmd.Flags().DurationVarP(&c.checkInterval, "check-interval", "", 100*time.Millisecond, "the interval of the total balance checks")
+	return cmd
+}
+
+func (c *Bank) Setup(ctx context.Context, env *cmd.CaseEnv) error {
+	fmt.Printf("accounts: %v\ntxn mode: %v\nconcurrency: %v\n", c.accounts, c.txnMode, c.cfg.Concurrency)
+	if c.accounts < 2 {
+		return fmt.Errorf("accounts should be at least 2")
+	}
+	if c.balance < 0 {
+		return fmt.Errorf("balance should not be negative")
+	}
+	switch c.txnMode {
+	case txnModeOptimistic, txnModePessimistic, txnModeMixed:
+	default:
+		return fmt.Errorf("unknown txn mode %v, should be one of optimistic, pessimistic and mixed", c.txnMode)
+	}
+	if c.isolation != "" {
+		isolation := strings.ToUpper(strings.Replace(c.isolation, " ", "-", -1))
+		switch isolation {
+		case "READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE":
+		default:
+			return fmt.Errorf("unknown isolation %v, should be such as repeatable-read or read-committed", c.isolation)
+		}
+		if !hasVar(c.cfg.SessionVars, "transaction_isolation") {
+			c.cfg.SessionVars = append(c.cfg.SessionVars, "transaction_isolation="+isolation)
+		}
+	}
+	c.cfg.DBName = "bank"
+	env.Runner.DefaultErrorPolicy(util.ErrClassWriteConflict, util.ErrPolicyContinue)
+	env.Runner.DefaultErrorPolicy(util.ErrClassDeadlock, util.ErrPolicyContinue)
+	env.Runner.DefaultErrorPolicy(util.ErrClassLockWaitTimeout, util.ErrPolicyContinue)
+	return env.Exec(ctx,
+		"drop table if exists accounts",
+		"create table accounts (id int, balance bigint not null, primary key (id))",
+	)
+}
+
+func (c *Bank) Load(ctx context.Context, env *cmd.CaseEnv) error {
+	return env.Insert(ctx, "accounts", c.accounts, func(i int) []interface{} {
+		return []interface{}{i, c.balance}
+	})
+}
+
+func (c *Bank) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	rnd := env.Rand(id)
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		return c.transfer(ctx, conn, rnd)
+	}), nil
+}
+
+// transfer transfers a random amount between 2 random accounts in a transaction,
+// nothing is transferred if the balance is not enough.
+func (c *Bank) transfer(ctx context.Context, conn *sql.Conn, rnd *rand.Rand) error {
+	from := rnd.Intn(c.accounts)
+	to := rnd.Intn(c.accounts - 1)
+	if to >= from {
+		to++
+	}
+	amount := rnd.Int63n(maxTransferAmount) + 1
+	mode := c.txnMode
+	if mode == txnModeMixed {
+		mode = txnModeOptimistic
+		if rnd.Intn(2) == 0 {
+			mode = txnModePessimistic
+		}
+	}
+	query := fmt.Sprintf("select id, balance from accounts where id in (%v, %v)", from, to)
+	if mode == txnModePessimistic {
+		query += " for update"
+	}
+
+	if _, err := conn.ExecContext(ctx, "begin "+mode); err != nil {
+		return err
+	}
+	rollback := func(err error) error {
+		conn.ExecContext(context.Background(), "rollback")
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return rollback(err)
+	}
+	var balance int64 = -1
+	for rows.Next() {
+		var id int
+		var b int64
+		if err := rows.Scan(&id, &b); err != nil {
+			rows.Close()
+			return rollback(err)
+		}
+		if id == from {
+			balance = b
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rollback(err)
+	}
+	if balance < amount {
+		return rollback(nil)
+	}
+	sqls := []string{
+		fmt.Sprintf("update accounts set balance = balance - %v where id = %v", amount, from),
+		fmt.Sprintf("update accounts set balance = balance + %v where id = %v", amount, to),
+	}
+	for _, s := range sqls {
+		if _, err := conn.ExecContext(ctx, s); err != nil {
+			return rollback(err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "commit"); err != nil {
+		return rollback(err)
+	}
+	atomic.AddInt64(&c.transfers, 1)
+	return nil
+}
+
+// check reads the total balance of the accounts in a snapshot, and records the violation.
+func (c *Bank) check(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	now := time.Now()
+	if _, err := conn.ExecContext(ctx, "start transaction with consistent snapshot"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "commit")
+	var accounts int
+	var total sql.NullInt64
+	err = conn.QueryRowContext(ctx, "select count(*), sum(balance) from accounts").Scan(&accounts, &total)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.checks, 1)
+	if accounts == c.accounts && total.Int64 == int64(c.accounts)*c.balance {
+		return nil
+	}
+	// the start ts is only available after the transaction is active in TiDB.
+	var ts sql.NullString
+	if conn.QueryRowContext(ctx, "select @@tidb_current_ts").Scan(&ts) != nil {
+		ts.String = ""
+	}
+	v := bankViolation{time: now, ts: ts.String, accounts: accounts, total: total.Int64}
+	c.mu.Lock()
+	c.violations = append(c.violations, v)
+	c.mu.Unlock()
+	fmt.Println(c.violationString(v))
+	return nil
+}
+
+func (c *Bank) violationString(v bankViolation) string {
+	s := fmt.Sprintf("total balance violation at %v", v.time.Format("2006-01-02 15:04:05.000"))
+	if v.ts != "" && v.ts != "0" {
+		s += fmt.Sprintf(" (ts %v)", v.ts)
+	}
+	return s + fmt.Sprintf(": %v accounts with total balance %v, expected %v accounts with total balance %v",
+		v.accounts, v.total, c.accounts, int64(c.accounts)*c.balance)
+}
+
+// Report checks the total balance every check interval, and prints the progress every interval.
+func (c *Bank) Report(ctx context.Context, env *cmd.CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	lastPrint := time.Now()
+	for util.Sleep(ctx, c.checkInterval) {
+		if err := c.check(ctx, db); err != nil && ctx.Err() == nil {
+			fmt.Printf("check total balance error: %v\n", err)
+		}
+		if time.Since(lastPrint) >= time.Second*time.Duration(c.interval) {
+			lastPrint = time.Now()
+			c.printProgress(env)
+		}
+	}
+	return nil
+}
+
+func (c *Bank) printProgress(env *cmd.CaseEnv) {
+	c.mu.Lock()
+	violations := len(c.violations)
+	c.mu.Unlock()
+	recorder := env.Runner.Recorder()
+	fmt.Printf("transfers: %v, checks: %v, violations: %v, write conflict: %v, deadlock: %v, lock wait timeout: %v\n",
+		atomic.LoadInt64(&c.transfers), atomic.LoadInt64(&c.checks), violations,
+		recorder.ErrorCount(util.ErrClassWriteConflict), recorder.ErrorCount(util.ErrClassDeadlock), recorder.ErrorCount(util.ErrClassLockWaitTimeout))
+}
+
+// Verify checks the total balance after the transfers stopped, and fails if any check found a violation.
+func (c *Bank) Verify(ctx context.Context, env *cmd.CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	if err := c.check(ctx, db); err != nil {
+		return err
+	}
+	c.printProgress(env)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.violations) == 0 {
+		return nil
+	}
+	// the violations are printed when they are found, the error only contains the first one.
+	failed := []string{fmt.Sprintf("%v total balance violation(s), the first is %v", len(c.violations), c.violationString(c.violations[0]))}
+	return &cmd.AssertionError{Failed: failed}
+}
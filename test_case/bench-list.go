@@ -7,18 +7,15 @@ import (
 	"fmt"
 	"github.com/crazycs520/testutil/cmd"
 	"github.com/crazycs520/testutil/config"
-	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
 	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
-	"time"
 )
 
 type BenchListPartitionTable struct {
+	cmd.BaseCase
 	cfg *config.Config
 
 	partitionNum      int
@@ -28,15 +25,11 @@ type BenchListPartitionTable struct {
 	Type              string
 	maxNum            int
 
-	qps         int64
-	avgTime     int64
-	wg          sync.WaitGroup
-	insertCount int64
-
 	cases map[string]benchListTestCase
+	ca    benchListTestCase
 }
 
-func NewBenchListPartitionTable(cfg *config.Config) cmd.CMDGenerater {
+func NewBenchListPartitionTable(cfg *config.Config) cmd.Case {
 	return &BenchListPartitionTable{
 		cfg:   cfg,
 		cases: make(map[string]benchListTestCase),
@@ -47,7 +40,6 @@ func (c *BenchListPartitionTable) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "bench-list-column",
 		Short:        "bench test for select list columns partition",
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	tpComment := []string{}
@@ -82,55 +74,24 @@ func (c *BenchListPartitionTable) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (c *BenchListPartitionTable) RunE(cmd *cobra.Command, args []string) error {
-	return c.Run()
-}
-
-func (c *BenchListPartitionTable) Run() error {
+func (c *BenchListPartitionTable) Setup(ctx context.Context, env *cmd.CaseEnv) error {
 	ca, ok := c.cases[c.Type]
 	if !ok {
 		return fmt.Errorf("unknow type: %v", c.Type)
 	}
-	err := ca.prepare()
-	if err != nil {
-		return err
-	}
-	err = ca.bench()
-	if err != nil {
+	c.ca = ca
+	return ca.prepare(ctx, env)
+}
+
+func (c *BenchListPartitionTable) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	return c.ca.newWorker(env, env.Rand(id), conn)
+}
+
+func (c *BenchListPartitionTable) exec(genSQL func() string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, genSQL())
 		return err
 	}
-	go func() {
-		for {
-			time.Sleep(time.Second)
-			fmt.Printf("qps: %v, avg: %v\n", atomic.LoadInt64(&c.qps), time.Duration(atomic.LoadInt64(&c.avgTime)).String())
-			atomic.StoreInt64(&c.qps, 0)
-		}
-	}()
-	c.wg.Wait()
-	return nil
-}
-
-func (c *BenchListPartitionTable) exec(genSQL func() string) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	count := int64(0)
-	start := time.Now()
-	for {
-		count++
-		sql := genSQL()
-		_, err := db.Exec(sql)
-		if err != nil {
-			return err
-		}
-		if count > 1000 || time.Since(start) > time.Second {
-			atomic.StoreInt64(&c.avgTime, int64(time.Since(start))/count)
-			count = 0
-			start = time.Now()
-		}
-		atomic.AddInt64(&c.qps, 1)
-	}
 }
 
 func (c *BenchListPartitionTable) registerBench(ca benchListTestCase) {
@@ -143,9 +104,9 @@ func (c *BenchListPartitionTable) registerBench(ca benchListTestCase) {
 type benchListTestCase interface {
 	Name() string
 	Comment() string
-	prepare() error
-	bench() error
-	benchSQL() string
+	prepare(ctx context.Context, env *cmd.CaseEnv) error
+	newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error)
+	benchSQL(rnd *rand.Rand) string
 }
 
 type benchRandSelect struct {
@@ -160,48 +121,17 @@ func (c *benchRandSelect) Comment() string {
 	return "bench rand select, without index"
 }
 
-func (c *benchRandSelect) checkTableExist(db *sql.DB) bool {
-	tableName := "t"
-	query := fmt.Sprintf("select id, a, b,name from %v limit 1", tableName)
-	_, err := db.Exec(query)
-	if err != nil {
-		fmt.Printf("table %v doesn't exists\n", tableName)
-		return false
-	}
-	query = fmt.Sprintf("select count(1) from %v", tableName)
-	valid := true
-	err = util.QueryRows(db, query, func(row, cols []string) error {
-		if len(row) != 1 {
-			valid = false
-			return nil
-		}
-		cnt, _ := strconv.Atoi(row[0])
-		valid = cnt == c.rows
-		if !valid {
-			fmt.Printf("table %v current rows is %v, expected rows id %v\n",
-				tableName, cnt, c.rows)
-		}
-		return nil
-	})
-	if err != nil {
-		fmt.Printf("table %v rows count error: %v\n", tableName, err)
-		return false
-	}
-	return valid
-}
-
-func (c *benchRandSelect) prepare() error {
+func (c *benchRandSelect) prepare(ctx context.Context, env *cmd.CaseEnv) error {
 	c.cfg.DBName = "bench_test"
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
 	if c.rows == 0 {
 		c.maxNum = c.partitionValueNum * c.partitionNum
 	}
-	exist := c.checkTableExist(db)
-	if exist {
-		return nil
+	tableName := c.cfg.DBName + ".t"
+	if rows, ok := env.TableRows(ctx, tableName); ok {
+		if rows == c.rows {
+			return nil
+		}
+		fmt.Printf("table %v current rows is %v, expected rows id %v\n", tableName, rows, c.rows)
 	}
 
 	create := bytes.Buffer{}
@@ -226,81 +156,21 @@ func (c *benchRandSelect) prepare() error {
 	}
 	c.maxNum = num
 	create.WriteString(")")
-	prepareSQLs := []string{
-		"drop table if exists t",
-		create.String(),
-	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
+	err := env.Exec(ctx, "drop table if exists t", create.String())
 	if err != nil {
 		return err
 	}
-	if c.rows == 0 {
-		return nil
-	}
-	return c.loadData()
+	return c.loadData(ctx, env)
 }
 
-func (c *benchRandSelect) loadData() error {
-	// prepare data.
-	step := (c.rows / c.cfg.Concurrency) + 1
-	if step < 10 {
-		return c.insertData(0, c.rows)
-	}
-	var wg sync.WaitGroup
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		wg.Add(1)
-		start := i * step
-		end := (i + 1) * step
-		if end > c.rows {
-			end = c.rows
-		}
-		go func() {
-			defer wg.Done()
-			err := c.insertData(start, end)
-			if err != nil {
-				fmt.Printf("insert data error: %v\n", err)
-			}
-		}()
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		ticker := time.NewTicker(time.Second)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				fmt.Printf("inserted rows: %v \n", atomic.LoadInt64(&c.insertCount))
-			}
-		}
-	}()
-	wg.Wait()
-	cancel()
-	return nil
-}
-
-func (c *benchRandSelect) insertData(start, end int) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for i := start; i < end; i++ {
-		letter := 'a' + byte(i%26)
-		name := make([]byte, 10)
-		for i := range name {
-			name[i] = letter
-		}
-		query := fmt.Sprintf("insert into t values (%v,%v,%v,'%v')", i, i, i, string(name))
-		_, err := db.Exec(query)
-		if err != nil {
-			return err
-		}
-		atomic.AddInt64(&c.insertCount, 1)
-	}
-	return nil
+func (c *benchRandSelect) loadData(ctx context.Context, env *cmd.CaseEnv) error {
+	return env.Insert(ctx, "t", c.rows, func(i int) []interface{} {
+		name := strings.Repeat(string(rune('a'+i%26)), 10)
+		return []interface{}{i, i, i, name}
+	})
 }
 
-func (c *benchRandSelect) benchSQL() string {
+func (c *benchRandSelect) benchSQL(rnd *rand.Rand) string {
 	sql := bytes.Buffer{}
 	sql.WriteString("select * from t where ")
 	colName := []string{"id", "a", "b"}
@@ -312,70 +182,36 @@ func (c *benchRandSelect) benchSQL() string {
 				sql.WriteString(" or ")
 			}
 		}
-		cn := rand.Intn(len(colName))
+		cn := rnd.Intn(len(colName))
 		col := colName[cn]
-		v := rand.Intn(c.maxNum * 2)
+		v := rnd.Intn(c.maxNum * 2)
 		sql.WriteString(fmt.Sprintf(" %v = %v ", col, v))
 	}
 	return sql.String()
 }
 
-func (c *BenchListPartitionTable) bench(genSQL func() string) error {
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
-			err := c.exec(func() string {
-				return genSQL()
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
-	return nil
-}
-
-func (c *BenchListPartitionTable) benchInTxnAndRollback(genSQL func() string) error {
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
-			db := util.GetSQLCli(c.cfg)
-			defer func() {
-				db.Close()
-			}()
-			count := int64(0)
-			start := time.Now()
-			for {
-				count++
-				txn, err := db.Begin()
-				if err != nil {
-					fmt.Println(err.Error())
-				}
-				sql := genSQL()
-				_, err = txn.Exec(sql)
-				if err != nil {
-					fmt.Println(err.Error())
-				}
-				err = txn.Rollback()
-				if err != nil {
-					fmt.Println(err.Error())
-				}
-				if count > 1000 || time.Since(start) > time.Second {
-					atomic.StoreInt64(&c.avgTime, int64(time.Since(start))/count)
-					count = 0
-					start = time.Now()
-				}
-				atomic.AddInt64(&c.qps, 1)
-			}
-		}()
-	}
-	return nil
+func (c *BenchListPartitionTable) bench(conn *sql.Conn, genSQL func() string) (cmd.Worker, error) {
+	return cmd.NewConnWorker(conn, c.exec(genSQL)), nil
 }
 
-func (c *benchRandSelect) bench() error {
-	return c.BenchListPartitionTable.bench(c.benchSQL)
+func (c *BenchListPartitionTable) benchInTxnAndRollback(conn *sql.Conn, genSQL func() string) (cmd.Worker, error) {
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		txn, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = txn.ExecContext(ctx, genSQL())
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		return txn.Rollback()
+	}), nil
+}
+
+func (c *benchRandSelect) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.bench(conn, func() string {
+		return c.benchSQL(rnd)
+	})
 }
 
 type benchSimpleSelect struct {
@@ -390,19 +226,21 @@ func (c *benchSimpleSelect) Comment() string {
 	return "bench simple select, without index, such as: select * from t where id=1"
 }
 
-func (c *benchSimpleSelect) benchSQL() string {
+func (c *benchSimpleSelect) benchSQL(rnd *rand.Rand) string {
 	sql := bytes.Buffer{}
 	sql.WriteString("select * from t where ")
 	colName := []string{"id", "a", "b"}
-	colIdx := rand.Intn(len(colName))
+	colIdx := rnd.Intn(len(colName))
 	col := colName[colIdx]
-	v := rand.Intn(c.maxNum * 2)
+	v := rnd.Intn(c.maxNum * 2)
 	sql.WriteString(fmt.Sprintf(" %v = %v ", col, v))
 	return sql.String()
 }
 
-func (c *benchSimpleSelect) bench() error {
-	return c.BenchListPartitionTable.bench(c.benchSQL)
+func (c *benchSimpleSelect) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.bench(conn, func() string {
+		return c.benchSQL(rnd)
+	})
 }
 
 type benchPointGet struct {
@@ -417,11 +255,7 @@ func (c *benchPointGet) Comment() string {
 	return "bench point get"
 }
 
-func (c *benchPointGet) prepare() error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
+func (c *benchPointGet) prepare(ctx context.Context, env *cmd.CaseEnv) error {
 	c.cfg.DBName = "bench_test"
 	create := bytes.Buffer{}
 	create.WriteString("create table t (id int,a int,b int, name varchar(10), unique index (id)) partition by list columns (id) (")
@@ -445,27 +279,22 @@ func (c *benchPointGet) prepare() error {
 	}
 	c.maxNum = num
 	create.WriteString(")")
-	prepareSQLs := []string{
-		"drop table if exists t",
-		create.String(),
-	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
+	err := env.Exec(ctx, "drop table if exists t", create.String())
 	if err != nil {
 		return err
 	}
-	if c.rows == 0 {
-		return nil
-	}
 	randSelect := &benchRandSelect{c.BenchListPartitionTable}
-	return randSelect.loadData()
+	return randSelect.loadData(ctx, env)
 }
 
-func (c *benchPointGet) benchSQL() string {
-	return fmt.Sprintf("select * from t where id = %v", rand.Intn(c.maxNum))
+func (c *benchPointGet) benchSQL(rnd *rand.Rand) string {
+	return fmt.Sprintf("select * from t where id = %v", rnd.Intn(c.maxNum))
 }
 
-func (c *benchPointGet) bench() error {
-	return c.BenchListPartitionTable.bench(c.benchSQL)
+func (c *benchPointGet) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.bench(conn, func() string {
+		return c.benchSQL(rnd)
+	})
 }
 
 type benchPreparePointGet struct {
@@ -480,35 +309,19 @@ func (c *benchPreparePointGet) Comment() string {
 	return "bench point get with prepare"
 }
 
-func (c *benchPreparePointGet) benchSQL() string {
+func (c *benchPreparePointGet) benchSQL(rnd *rand.Rand) string {
 	return ""
 }
 
-func (c *benchPreparePointGet) bench() error {
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		c.wg.Add(1)
-		go func() {
-			defer c.wg.Done()
-			db := util.GetSQLCli(c.cfg)
-			defer func() {
-				db.Close()
-			}()
-			stmt, err := db.Prepare("select * from t where id = ?")
-			if err != nil {
-				fmt.Println(err.Error())
-				return
-			}
-			for {
-				_, err := stmt.Exec(rand.Intn(c.maxNum * 2))
-				if err != nil {
-					fmt.Println(err.Error())
-					return
-				}
-				atomic.AddInt64(&c.qps, 1)
-			}
-		}()
+func (c *benchPreparePointGet) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	stmt, err := conn.PrepareContext(env.Runner.Context(), "select * from t where id = ?")
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		_, err := stmt.ExecContext(ctx, rnd.Intn(c.maxNum*2))
+		return err
+	}), nil
 }
 
 type benchSimpleDelete struct {
@@ -523,19 +336,21 @@ func (c *benchSimpleDelete) Comment() string {
 	return "bench simple delete 1 row, without index, such as: delete from t where id=1"
 }
 
-func (c *benchSimpleDelete) benchSQL() string {
+func (c *benchSimpleDelete) benchSQL(rnd *rand.Rand) string {
 	sql := bytes.Buffer{}
 	sql.WriteString("delete from t where ")
 	colName := []string{"id", "a", "b"}
-	colIdx := rand.Intn(len(colName))
+	colIdx := rnd.Intn(len(colName))
 	col := colName[colIdx]
-	v := rand.Intn(c.maxNum * 2)
+	v := rnd.Intn(c.maxNum * 2)
 	sql.WriteString(fmt.Sprintf(" %v = %v ", col, v))
 	return sql.String()
 }
 
-func (c *benchSimpleDelete) bench() error {
-	return c.BenchListPartitionTable.bench(c.benchSQL)
+func (c *benchSimpleDelete) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.bench(conn, func() string {
+		return c.benchSQL(rnd)
+	})
 }
 
 type benchSimpleBatchDelete struct {
@@ -550,15 +365,15 @@ func (c *benchSimpleBatchDelete) Comment() string {
 	return "bench simple delete a batch rows, without index, such as: delete from t where delete from t where id > 100 and id < 200"
 }
 
-func (c *benchSimpleBatchDelete) benchSQL() string {
+func (c *benchSimpleBatchDelete) benchSQL(rnd *rand.Rand) string {
 	sql := bytes.Buffer{}
 	sql.WriteString("delete from t where id > 100 and id < 200")
 	return sql.String()
 }
 
-func (c *benchSimpleBatchDelete) bench() error {
-	return c.BenchListPartitionTable.benchInTxnAndRollback(func() string {
-		return c.benchSQL()
+func (c *benchSimpleBatchDelete) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.benchInTxnAndRollback(conn, func() string {
+		return c.benchSQL(rnd)
 	})
 }
 
@@ -574,9 +389,9 @@ func (c *benchSimpleBatchDeleteIn) Comment() string {
 	return "bench simple delete a batch rows, without index, such as: delete from t where delete from t where id in (1,2,3,4,5,6,7,8,9,10)"
 }
 
-func (c *benchSimpleBatchDeleteIn) benchSQL() string {
+func (c *benchSimpleBatchDeleteIn) benchSQL(rnd *rand.Rand) string {
 	sql := bytes.Buffer{}
-	v := rand.Intn(c.rows)
+	v := rnd.Intn(c.rows)
 	sql.WriteString("delete from t where id in (")
 	for i := 0; i < 10; i++ {
 		if i > 0 {
@@ -588,8 +403,8 @@ func (c *benchSimpleBatchDeleteIn) benchSQL() string {
 	return sql.String()
 }
 
-func (c *benchSimpleBatchDeleteIn) bench() error {
-	return c.BenchListPartitionTable.benchInTxnAndRollback(func() string {
-		return c.benchSQL()
+func (c *benchSimpleBatchDeleteIn) newWorker(env *cmd.CaseEnv, rnd *rand.Rand, conn *sql.Conn) (cmd.Worker, error) {
+	return c.BenchListPartitionTable.benchInTxnAndRollback(conn, func() string {
+		return c.benchSQL(rnd)
 	})
 }
@@ -1,8 +1,8 @@
 package test_case
 
 import (
-	"database/sql"
 	"github.com/crazycs520/testutil/cmd"
+	"strings"
 )
 
 func init() {
@@ -13,19 +13,16 @@ func init() {
 	cmd.RegisterCaseCmd(NewStressCop)
 	cmd.RegisterCaseCmd(NewIndexLookUpWrongPlan)
 	cmd.RegisterCaseCmd(NewIndexHashJoinPlan)
+	cmd.RegisterCaseCmd(NewBank)
+	cmd.RegisterCaseCmd(NewDeadlock)
 }
 
-func prepare(db *sql.DB, dbName string, sqls []string) error {
-	ss := []string{
-		"create database if not exists " + dbName,
-		"use " + dbName,
-	}
-	sqls = append(ss, sqls...)
-	for _, s := range sqls {
-		_, err := db.Exec(s)
-		if err != nil {
-			return err
+// hasVar returns whether the variables of `name=value` contain the name.
+func hasVar(vars []string, name string) bool {
+	for _, v := range vars {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(v, "=", 2)[0]), name) {
+			return true
 		}
 	}
-	return nil
+	return false
 }
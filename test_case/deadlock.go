@@ -0,0 +1,171 @@
+package test_case
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/cmd"
+	"github.com/crazycs520/testutil/config"
+	"github.com/crazycs520/testutil/stats"
+	"github.com/crazycs520/testutil/util"
+	"github.com/spf13/cobra"
+	"sync/atomic"
+	"time"
+)
+
+// Deadlock locks the hot rows in opposite orders in pessimistic transactions,
+// so the transactions form lock cycles and meet deadlocks or lock wait timeouts.
+type Deadlock struct {
+	cmd.BaseCase
+	cfg *config.Config
+
+	cycle           int
+	hotKeys         int
+	lockWaitTimeout int
+	hold            time.Duration
+	interval        int64
+
+	txns int64
+	// detect and lockWait are the latencies of the lock statements which meet
+	// deadlock and lock wait timeout, they are not counted as the run statements.
+	detect   *stats.Recorder
+	lockWait *stats.Recorder
+}
+
+func NewDeadlock(cfg *config.Config) cmd.Case {
+	return &Deadlock{
+		cfg: cfg,
+	}
+}
+
+func (c *Deadlock) Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "deadlock",
+		Short:        "test deadlock and lock wait timeout in pessimistic transaction case",
+		Long:         `lock the hot rows in opposite orders in pessimistic transactions, and report the deadlocks and lock wait timeouts`,
+		SilenceUsage: true,
+	}
+	cmd.Flags().IntVarP(&c.cycle, "cycle", "", 2, "the number of the transactions in a lock cycle, every transaction locks cycle rows")
+	cmd.Flags().IntVarP(&c.hotKeys, "hot-keys", "", 10, "the number of the hot rows, should not be less than cycle")
+	cmd.Flags().IntVarP(&c.lockWaitTimeout, "lock-wait-timeout", "", 0, "innodb_lock_wait_timeout of the sessions in seconds, 0 means the server default")
+	cmd.Flags().DurationVarP(&c.hold, "hold", "", 10*time.Millisecond, "the time to hold the lock before locking the next row")
+	cmd.Flags().Int64VarP(&c.interval, "interval", "", 1, "print message interval seconds")
+	return cmd
+}
+
+func (c *Deadlock) Setup(ctx context.Context, env *cmd.CaseEnv) error {
+	fmt.Printf("cycle: %v\nhot keys: %v\nconcurrency: %v\n", c.cycle, c.hotKeys, c.cfg.Concurrency)
+	if c.cycle < 2 {
+		return fmt.Errorf("cycle should be at least 2")
+	}
+	if c.hotKeys < c.cycle {
+		return fmt.Errorf("hot-keys should not be less than cycle")
+	}
+	c.cfg.DBName = "deadlock"
+	c.detect, c.lockWait = stats.NewRecorder(), stats.NewRecorder()
+	if !hasVar(c.cfg.SessionVars, "tidb_txn_mode") {
+		c.cfg.SessionVars = append(c.cfg.SessionVars, "tidb_txn_mode=pessimistic")
+	}
+	if c.lockWaitTimeout > 0 && !hasVar(c.cfg.SessionVars, "innodb_lock_wait_timeout") {
+		c.cfg.SessionVars = append(c.cfg.SessionVars, fmt.Sprintf("innodb_lock_wait_timeout=%v", c.lockWaitTimeout))
+	}
+	env.Runner.DefaultErrorPolicy(util.ErrClassDeadlock, util.ErrPolicyContinue)
+	env.Runner.DefaultErrorPolicy(util.ErrClassLockWaitTimeout, util.ErrPolicyContinue)
+	env.Runner.DefaultErrorPolicy(util.ErrClassWriteConflict, util.ErrPolicyContinue)
+	return env.Exec(ctx,
+		"drop table if exists t",
+		"create table t (id int, count bigint, primary key (id))",
+	)
+}
+
+func (c *Deadlock) Load(ctx context.Context, env *cmd.CaseEnv) error {
+	return env.Insert(ctx, "t", c.hotKeys, func(i int) []interface{} {
+		return []interface{}{i, 0}
+	})
+}
+
+func (c *Deadlock) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	// every cycle workers are a group which locks the same rows, the workers of a
+	// group start locking the rows from different positions, so they wait for
+	// each other and form a lock cycle.
+	rotation := id % c.cycle
+	base := id / c.cycle * c.cycle % c.hotKeys
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		return c.lockCycle(ctx, conn, base, rotation)
+	}), nil
+}
+
+// lockCycle locks cycle continuous hot rows from base in the order of the rotation in a pessimistic
+// transaction, the latencies of the lock statements which meet deadlock or lock wait timeout are recorded.
+func (c *Deadlock) lockCycle(ctx context.Context, conn *sql.Conn, base, rotation int) error {
+	if _, err := conn.ExecContext(ctx, "begin pessimistic"); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.txns, 1)
+	rollback := func(err error) error {
+		conn.ExecContext(context.Background(), "rollback")
+		return err
+	}
+	for i := 0; i < c.cycle; i++ {
+		if i > 0 && !util.Sleep(ctx, c.hold) {
+			return rollback(ctx.Err())
+		}
+		id := (base + (rotation+i)%c.cycle) % c.hotKeys
+		start := time.Now()
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("update t set count = count + 1 where id = %v", id))
+		if err != nil {
+			switch util.ClassifyError(err) {
+			case util.ErrClassDeadlock:
+				c.detect.Record(time.Since(start))
+			case util.ErrClassLockWaitTimeout:
+				c.lockWait.Record(time.Since(start))
+			}
+			return rollback(err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "commit"); err != nil {
+		return rollback(err)
+	}
+	return nil
+}
+
+// Report prints the rates of the deadlocks and the lock wait timeouts, and the
+// recent deadlocks and lock waits of the cluster.
+func (c *Deadlock) Report(ctx context.Context, env *cmd.CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	for util.Sleep(ctx, time.Second*time.Duration(c.interval)) {
+		c.printRates(env)
+		fmt.Println("----------- recent deadlocks -------------")
+		err := util.QueryAndPrint(db, "select * from information_schema.deadlocks order by deadlock_id desc, try_lock_trx_id limit 10")
+		if err != nil {
+			fmt.Printf("query deadlocks error: %v\n", err)
+		}
+		fmt.Println("----------- lock waits -------------")
+		err = util.QueryAndPrint(db, "select * from information_schema.data_lock_waits limit 10")
+		if err != nil {
+			fmt.Printf("query lock waits error: %v\n", err)
+		}
+		fmt.Printf("---------------------------[ END ]-------------------------\n\n")
+	}
+	c.printRates(env)
+	return nil
+}
+
+func (c *Deadlock) printRates(env *cmd.CaseEnv) {
+	rec := env.Runner.Recorder()
+	txns := atomic.LoadInt64(&c.txns)
+	deadlocks := rec.ErrorCount(util.ErrClassDeadlock)
+	timeouts := rec.ErrorCount(util.ErrClassLockWaitTimeout)
+	rate := func(n int64) float64 {
+		if txns == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(txns)
+	}
+	fmt.Printf("txns: %v, deadlock: %v (%.2f%%), lock wait timeout: %v (%.2f%%)\n", txns, deadlocks, rate(deadlocks), timeouts, rate(timeouts))
+	fmt.Printf("deadlock detection latency: %v\n", c.detect.Summary())
+	fmt.Printf("lock wait timeout latency: %v\n", c.lockWait.Summary())
+}
@@ -1,6 +1,8 @@
 package test_case
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/crazycs520/testutil/cmd"
 	"github.com/crazycs520/testutil/config"
@@ -11,6 +13,7 @@ import (
 )
 
 type IndexHashJoinPlan struct {
+	cmd.BaseCase
 	cfg       *config.Config
 	tableName string
 	tblInfo   *data.TableInfo
@@ -21,7 +24,7 @@ type IndexHashJoinPlan struct {
 	insertCount int64
 }
 
-func NewIndexHashJoinPlan(cfg *config.Config) cmd.CMDGenerater {
+func NewIndexHashJoinPlan(cfg *config.Config) cmd.Case {
 	return &IndexHashJoinPlan{
 		cfg: cfg,
 	}
@@ -31,7 +34,6 @@ func (c *IndexHashJoinPlan) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "index-hash-join",
 		Short:        "stress test for index hash join.",
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	cmd.Flags().StringVarP(&c.query, "sql", "", "", "execute query")
@@ -40,11 +42,7 @@ func (c *IndexHashJoinPlan) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (c *IndexHashJoinPlan) RunE(cmd *cobra.Command, args []string) error {
-	return c.Run()
-}
-
-func (c *IndexHashJoinPlan) prepare() error {
+func (c *IndexHashJoinPlan) Setup(ctx context.Context, env *cmd.CaseEnv) error {
 	c.cfg.DBName = "stress_test"
 	c.tableName = "t"
 	tblInfo, err := data.NewTableInfo(c.cfg.DBName, c.tableName, []data.ColumnDef{
@@ -76,53 +74,35 @@ func (c *IndexHashJoinPlan) prepare() error {
 		return err
 	}
 	c.tblInfo = tblInfo
+	return nil
+}
+
+func (c *IndexHashJoinPlan) Load(ctx context.Context, env *cmd.CaseEnv) error {
 	load := data.NewLoadDataSuit(c.cfg)
-	return load.Prepare(tblInfo, c.rows, 2000)
+	return load.Prepare(ctx, c.tblInfo, c.rows, 2000)
 }
 
-func (c *IndexHashJoinPlan) Run() error {
-	err := c.prepare()
-	if err != nil {
-		fmt.Println("prepare data meet error: ", err)
-		return err
-	}
-	fmt.Println("finish prepare data")
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		go func() {
-			err := c.exec(func() string {
-				if c.query != "" {
-					return c.query
-				}
-				return fmt.Sprintf("select /*+ INL_HASH_JOIN(t2,t1) */ count(*) from %[1]v t1 join %[1]v t2 where t1.a=t2.b;", c.tblInfo.DBTableName())
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
+func (c *IndexHashJoinPlan) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	return cmd.NewConnWorker(conn, c.exec(func() string {
+		if c.query != "" {
+			return c.query
+		}
+		return fmt.Sprintf("select /*+ INL_HASH_JOIN(t2,t1) */ count(*) from %[1]v t1 join %[1]v t2 where t1.a=t2.b;", c.tblInfo.DBTableName())
+	})), nil
+}
+
+func (c *IndexHashJoinPlan) Report(ctx context.Context, env *cmd.CaseEnv) error {
 	var likeCond string
 	if c.query != "" {
 		likeCond = c.query + "%%"
 	} else {
 		likeCond = fmt.Sprintf("select /*+ INL_HASH_JOIN(t2,t1) */ count(*) from %[1]v t1 join%%", c.tblInfo.DBTableName())
 	}
-	err = util.PrintSlowQueryInfo(likeCond, time.Second, c.cfg)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	return err
+	return util.PrintSlowQueryInfo(ctx, likeCond, time.Second, c.cfg)
 }
-
-func (c *IndexHashJoinPlan) exec(genSQL func() string) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		sql := genSQL()
-		_, err := db.Exec(sql)
-		if err != nil {
-			return err
-		}
+func (c *IndexHashJoinPlan) exec(genSQL func() string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, genSQL())
+		return err
 	}
 }
@@ -1,6 +1,8 @@
 package test_case
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/crazycs520/testutil/cmd"
 	"github.com/crazycs520/testutil/config"
@@ -11,6 +13,7 @@ import (
 )
 
 type IndexLookUpWrongPlan struct {
+	cmd.BaseCase
 	cfg       *config.Config
 	tableName string
 	tblInfo   *data.TableInfo
@@ -20,7 +23,7 @@ type IndexLookUpWrongPlan struct {
 	insertCount int64
 }
 
-func NewIndexLookUpWrongPlan(cfg *config.Config) cmd.CMDGenerater {
+func NewIndexLookUpWrongPlan(cfg *config.Config) cmd.Case {
 	return &IndexLookUpWrongPlan{
 		cfg: cfg,
 	}
@@ -30,7 +33,6 @@ func (c *IndexLookUpWrongPlan) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "index-lookup",
 		Short:        "stress test for index lookup in wrong plan.",
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	cmd.Flags().IntVarP(&c.rows, "rows", "", 100000, "test table rows")
@@ -38,11 +40,7 @@ func (c *IndexLookUpWrongPlan) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (c *IndexLookUpWrongPlan) RunE(cmd *cobra.Command, args []string) error {
-	return c.Run()
-}
-
-func (c *IndexLookUpWrongPlan) prepare() error {
+func (c *IndexLookUpWrongPlan) Setup(ctx context.Context, env *cmd.CaseEnv) error {
 	c.cfg.DBName = "stress_test"
 	c.tableName = "t_index_lookup"
 	tblInfo, err := data.NewTableInfo(c.cfg.DBName, c.tableName, []data.ColumnDef{
@@ -72,44 +70,26 @@ func (c *IndexLookUpWrongPlan) prepare() error {
 		return err
 	}
 	c.tblInfo = tblInfo
+	return nil
+}
+
+func (c *IndexLookUpWrongPlan) Load(ctx context.Context, env *cmd.CaseEnv) error {
 	load := data.NewLoadDataSuit(c.cfg)
-	return load.Prepare(tblInfo, c.rows, 2000)
+	return load.Prepare(ctx, c.tblInfo, c.rows, 2000)
 }
 
-func (c *IndexLookUpWrongPlan) Run() error {
-	err := c.prepare()
-	if err != nil {
-		fmt.Println("prepare data meet error: ", err)
-		return err
-	}
-	fmt.Println("finish prepare data")
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		go func() {
-			err := c.exec(func() string {
-				return fmt.Sprintf("select sum(a*b) from %v use index (idx0) where a < 1000000", c.tblInfo.DBTableName())
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
-	err = util.PrintSlowQueryInfo(fmt.Sprintf("select sum(a*b) from %v use index%%", c.tblInfo.DBTableName()), time.Second, c.cfg)
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	return err
+func (c *IndexLookUpWrongPlan) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	return cmd.NewConnWorker(conn, c.exec(func() string {
+		return fmt.Sprintf("select sum(a*b) from %v use index (idx0) where a < 1000000", c.tblInfo.DBTableName())
+	})), nil
 }
 
-func (c *IndexLookUpWrongPlan) exec(genSQL func() string) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		sql := genSQL()
-		_, err := db.Exec(sql)
-		if err != nil {
-			return err
-		}
+func (c *IndexLookUpWrongPlan) Report(ctx context.Context, env *cmd.CaseEnv) error {
+	return util.PrintSlowQueryInfo(ctx, fmt.Sprintf("select sum(a*b) from %v use index%%", c.tblInfo.DBTableName()), time.Second, c.cfg)
+}
+func (c *IndexLookUpWrongPlan) exec(genSQL func() string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, genSQL())
+		return err
 	}
 }
@@ -0,0 +1,117 @@
+package test_case
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/crazycs520/testutil/cmd"
+	"github.com/crazycs520/testutil/util"
+	"sort"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxReportedMismatches is the max mismatching ids printed by the verification.
+const maxReportedMismatches = 20
+
+// updateTracker counts the increments of `count` of every id on the client
+// side, so the lost or duplicated updates can be found after the run. The
+// update whose result is unknown, such as the connection is broken before
+// the response, is counted as uncertain.
+type updateTracker struct {
+	succeeded []int64
+	uncertain []int64
+}
+
+func newUpdateTracker(ids int) *updateTracker {
+	return &updateTracker{
+		succeeded: make([]int64, ids),
+		uncertain: make([]int64, ids),
+	}
+}
+
+// record records the result of the update of id.
+func (t *updateTracker) record(id int, err error) {
+	if err == nil {
+		atomic.AddInt64(&t.succeeded[id], 1)
+	} else if isUncertain(err) {
+		atomic.AddInt64(&t.uncertain[id], 1)
+	}
+}
+
+// isUncertain returns whether the update may have been committed although it returns err.
+func isUncertain(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return util.ClassifyError(err) == util.ErrClassUndetermined
+	}
+	return true
+}
+
+// verify compares the counts of the table with the succeeded updates, the
+// count of every id should be in [succeeded, succeeded+uncertain].
+func (t *updateTracker) verify(ctx context.Context, db *sql.DB, table string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("select id, count from %v", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	actual := make(map[int]int64, len(t.succeeded))
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		actual[id] += count
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var mismatches []string
+	var total, uncertain int64
+	ids := make([]int, 0, len(actual))
+	for id := range actual {
+		ids = append(ids, id)
+	}
+	for id := range t.succeeded {
+		if _, ok := actual[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		var succeeded, maybe int64
+		if id >= 0 && id < len(t.succeeded) {
+			succeeded, maybe = atomic.LoadInt64(&t.succeeded[id]), atomic.LoadInt64(&t.uncertain[id])
+		}
+		total += succeeded
+		uncertain += maybe
+		count := actual[id]
+		switch {
+		case count < succeeded:
+			mismatches = append(mismatches, fmt.Sprintf("id %v lost %v update(s): count %v, succeeded %v", id, succeeded-count, count, succeeded))
+		case count > succeeded+maybe:
+			mismatches = append(mismatches, fmt.Sprintf("id %v has %v duplicated update(s): count %v, succeeded %v, uncertain %v", id, count-succeeded-maybe, count, succeeded, maybe))
+		}
+	}
+	fmt.Printf("verify: %v ids, %v succeeded updates, %v uncertain updates, %v mismatching ids\n", len(ids), total, uncertain, len(mismatches))
+	if len(mismatches) == 0 {
+		return nil
+	}
+	for i, m := range mismatches {
+		if i == maxReportedMismatches {
+			fmt.Printf("... and %v more mismatching ids\n", len(mismatches)-i)
+			break
+		}
+		fmt.Println(m)
+	}
+	failed := mismatches
+	if len(failed) > maxReportedMismatches {
+		failed = append(failed[:maxReportedMismatches:maxReportedMismatches], fmt.Sprintf("%v more", len(mismatches)-maxReportedMismatches))
+	}
+	return &cmd.AssertionError{Failed: failed}
+}
@@ -1,108 +1,80 @@
 package test_case
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/crazycs520/testutil/cmd"
 	"github.com/crazycs520/testutil/config"
 	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
 	"math/rand"
-	"strings"
-	"sync/atomic"
 	"time"
 )
 
 type ReadWriteConflict struct {
+	cmd.BaseCase
 	cfg *config.Config
 
 	probability int
 	interval    int64
-	conflictErr int64
+	tracker     *updateTracker
 }
 
-func NewReadWriteConflict(cfg *config.Config) cmd.CMDGenerater {
+func NewReadWriteConflict(cfg *config.Config) cmd.Case {
 	return &ReadWriteConflict{
 		cfg: cfg,
 	}
 }
 
-func (c *ReadWriteConflict) Run() error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
+func (c *ReadWriteConflict) Setup(ctx context.Context, env *cmd.CaseEnv) error {
+	fmt.Printf("probability: %v\nconcurrency: %v\n", c.probability, c.cfg.Concurrency)
+	if c.probability <= 0 {
+		return fmt.Errorf("probability should be positive")
+	}
+	c.tracker = newUpdateTracker(c.probability)
 	c.cfg.DBName = "read_write_conflict"
-	prepareSQLs := []string{
+	env.Runner.DefaultErrorPolicy(util.ErrClassWriteConflict, util.ErrPolicyContinue)
+	return env.Exec(ctx,
 		"drop table if exists t",
 		"create table t (id int, name varchar(10), count bigint, unique index (id))",
-	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
-	if err != nil {
-		return err
-	}
-	for i := 0; i < c.cfg.Concurrency; i += 2 {
-		go func() {
-			err := c.update()
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-		go func() {
-			err := c.read()
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
-	err = c.print()
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	return err
+	)
 }
 
-func (c *ReadWriteConflict) update() error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		id := rand.Intn(c.probability)
-		sql := fmt.Sprintf("insert into t values (%v,'aaa', %v) on duplicate key update count=count+1;", id, 1)
-		_, err := db.Exec(sql)
-		if err != nil {
-			if strings.Contains(err.Error(), "Write conflict") {
-				atomic.AddInt64(&c.conflictErr, 1)
-				continue
-			}
-			return err
-		}
+func (c *ReadWriteConflict) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	rnd := env.Rand(id)
+	if id%2 == 0 {
+		return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+			return c.update(ctx, conn, rnd)
+		}), nil
 	}
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		return c.read(ctx, conn, rnd)
+	}), nil
 }
 
-func (c *ReadWriteConflict) read() error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		id := rand.Intn(c.probability)
-		sql := fmt.Sprintf("select * from t where id = %v", id)
-		_, err := db.Exec(sql)
-		if err != nil {
-			return err
-		}
-	}
+func (c *ReadWriteConflict) update(ctx context.Context, conn *sql.Conn, rnd *rand.Rand) error {
+	id := rnd.Intn(c.probability)
+	sql := fmt.Sprintf("insert into t values (%v,'aaa', %v) on duplicate key update count=count+1;", id, 1)
+	_, err := conn.ExecContext(ctx, sql)
+	c.tracker.record(id, err)
+	return err
+}
+
+func (c *ReadWriteConflict) read(ctx context.Context, conn *sql.Conn, rnd *rand.Rand) error {
+	id := rnd.Intn(c.probability)
+	sql := fmt.Sprintf("select * from t where id = %v", id)
+	_, err := conn.ExecContext(ctx, sql)
+	return err
 }
 
-func (c *ReadWriteConflict) print() error {
+func (c *ReadWriteConflict) Report(ctx context.Context, env *cmd.CaseEnv) error {
 	start := time.Now()
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		time.Sleep(time.Second * time.Duration(c.interval))
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	for util.Sleep(ctx, time.Second*time.Duration(c.interval)) {
 		query := fmt.Sprintf("select avg(query_time),count(*) from information_schema.cluster_slow_query where db='%s' and query like 'select * from t where id%%' and time > '%s' and time < now()", c.cfg.DBName, util.FormatTimeForQuery(start))
 		err := util.QueryAndPrint(db, query)
 		if err != nil {
@@ -115,9 +87,20 @@ func (c *ReadWriteConflict) print() error {
 			return err
 		}
 		fmt.Println("------------------------")
-		fmt.Printf("conflict error count: %v \n", atomic.LoadInt64(&c.conflictErr))
+		fmt.Printf("conflict error count: %v \n", env.Runner.Recorder().ErrorCount(util.ErrClassWriteConflict))
 		fmt.Printf("---------------------------[ END ]-------------------------\n\n")
 	}
+	fmt.Printf("conflict error count: %v \n", env.Runner.Recorder().ErrorCount(util.ErrClassWriteConflict))
+	return nil
+}
+
+// Verify checks there is no lost or duplicated update.
+func (c *ReadWriteConflict) Verify(ctx context.Context, env *cmd.CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	return c.tracker.verify(ctx, db, "t")
 }
 
 func (c *ReadWriteConflict) Cmd() *cobra.Command {
@@ -125,15 +108,9 @@ func (c *ReadWriteConflict) Cmd() *cobra.Command {
 		Use:          "read-write-conflict",
 		Short:        "test read-write conflict case",
 		Long:         `test for read-write conflict case`,
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	cmd.Flags().IntVarP(&c.probability, "probability", "", 100, "conflict probability, rand( n )")
 	cmd.Flags().Int64VarP(&c.interval, "interval", "", 1, "print message interval seconds")
 	return cmd
 }
-
-func (c *ReadWriteConflict) RunE(cmd *cobra.Command, args []string) error {
-	fmt.Printf("probability: %v\nconcurrency: %v\n", c.probability, c.cfg.Concurrency)
-	return c.Run()
-}
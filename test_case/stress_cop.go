@@ -8,22 +8,22 @@ import (
 	"github.com/crazycs520/testutil/config"
 	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
-	"strconv"
-	"sync"
-	"sync/atomic"
+	"strings"
 	"time"
 )
 
 type StressCop struct {
+	cmd.BaseCase
 	cfg       *config.Config
 	tableName string
 
-	rows        int
-	interval    int64
-	insertCount int64
+	rows     int
+	interval int64
+	// exist is true if the table with the expected rows exists, the data is not loaded again.
+	exist bool
 }
 
-func NewStressCop(cfg *config.Config) cmd.CMDGenerater {
+func NewStressCop(cfg *config.Config) cmd.Case {
 	return &StressCop{
 		cfg: cfg,
 	}
@@ -33,7 +33,6 @@ func (c *StressCop) Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:          "stress-cop",
 		Short:        "stress test for tikv coprocessor, should disable cop-cache first.",
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	cmd.Flags().IntVarP(&c.rows, "rows", "", 100000, "test table rows")
@@ -41,179 +40,75 @@ func (c *StressCop) Cmd() *cobra.Command {
 	return cmd
 }
 
-func (c *StressCop) RunE(cmd *cobra.Command, args []string) error {
-	return c.Run()
-}
-
 func (c *StressCop) queryTableName() string {
 	return c.cfg.DBName + "." + c.tableName
 }
 
-func (c *StressCop) checkTableExist(db *sql.DB) bool {
-	query := fmt.Sprintf("select id, name, count, age from %v limit 1", c.queryTableName())
-	_, err := db.Exec(query)
-	if err != nil {
-		fmt.Printf("table %v doesn't exists\n", c.queryTableName())
-		return false
-	}
-	query = fmt.Sprintf("select count(1) from %v", c.queryTableName())
-	valid := true
-	err = util.QueryRows(db, query, func(row, cols []string) error {
-		if len(row) != 1 {
-			valid = false
-			return nil
-		}
-		cnt, _ := strconv.Atoi(row[0])
-		valid = cnt == c.rows
-		if !valid {
-			fmt.Printf("table %v current rows is %v, expected rows id %v\n",
-				c.queryTableName(), cnt, c.rows)
-		}
-		return nil
-	})
-	if err != nil {
-		fmt.Printf("table %v rows count error: %v\n", c.queryTableName(), err)
-		return false
-	}
-	return valid
-}
-
-func (c *StressCop) prepare() error {
+func (c *StressCop) Setup(ctx context.Context, env *cmd.CaseEnv) error {
 	c.cfg.DBName = "stress_test"
 	c.tableName = "t_cop"
-
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	exist := c.checkTableExist(db)
-	if exist {
+	rows, ok := env.TableRows(ctx, c.queryTableName())
+	if ok && rows == c.rows {
+		c.exist = true
 		return nil
 	}
-	prepareSQLs := []string{
+	if ok {
+		fmt.Printf("table %v current rows is %v, expected rows id %v\n", c.queryTableName(), rows, c.rows)
+	}
+	err := env.Exec(ctx,
 		fmt.Sprintf("drop table if exists %v", c.tableName),
 		fmt.Sprintf("create table %v (id int, name varchar(10), count bigint, age int, primary key (id))", c.tableName),
-	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
+	)
 	if err != nil {
 		return err
 	}
 	// split region.
 	if c.rows > 100000 {
+		db, err := env.DB()
+		if err != nil {
+			return err
+		}
 		split := fmt.Sprintf("split table %v between (0) and (%v) regions %v;", c.queryTableName(), c.rows, c.rows/100000)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		_, err := db.ExecContext(ctx, split)
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		_, err = db.ExecContext(ctx, split)
 		if err != nil {
 			fmt.Printf("split region error: %v\n", err)
 		}
 		cancel()
 	}
-
-	// prepare data.
-	step := (c.rows / c.cfg.Concurrency) + 1
-	if step < 10 {
-		return c.insertData(0, c.rows)
-	}
-	var wg sync.WaitGroup
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		wg.Add(1)
-		start := i * step
-		end := (i + 1) * step
-		if end > c.rows {
-			end = c.rows
-		}
-		go func() {
-			defer wg.Done()
-			err := c.insertData(start, end)
-			if err != nil {
-				fmt.Printf("insert data error: %v\n", err)
-			}
-		}()
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		ticker := time.NewTicker(time.Second)
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				fmt.Printf("inserted rows: %v \n", atomic.LoadInt64(&c.insertCount))
-			}
-		}
-	}()
-	wg.Wait()
-	cancel()
 	return nil
 }
 
-func (c *StressCop) insertData(start, end int) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for i := start; i < end; i++ {
-		letter := 'a' + byte(i%26)
-		name := make([]byte, 10)
-		for i := range name {
-			name[i] = letter
-		}
-		query := fmt.Sprintf("insert into %v values (%v,'%v',%v,%v)", c.queryTableName(), i, string(name), i, i)
-		_, err := db.Exec(query)
-		if err != nil {
-			return err
-		}
-		atomic.AddInt64(&c.insertCount, 1)
+func (c *StressCop) Load(ctx context.Context, env *cmd.CaseEnv) error {
+	if c.exist {
+		return nil
 	}
-	return nil
+	return env.Insert(ctx, c.queryTableName(), c.rows, func(i int) []interface{} {
+		name := strings.Repeat(string(rune('a'+i%26)), 10)
+		return []interface{}{i, name, i, i}
+	})
 }
 
-func (c *StressCop) Run() error {
-	err := c.prepare()
-	if err != nil {
-		fmt.Println("prepare data meet error: ", err)
-		return err
-	}
-	fmt.Println("finish prepare data")
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		go func() {
-			err := c.exec(func() string {
-				return fmt.Sprintf("select sum(id*count*age) from %v", c.queryTableName())
-			})
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
-	err = c.print()
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-	return err
+func (c *StressCop) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	return cmd.NewConnWorker(conn, c.exec(func() string {
+		return fmt.Sprintf("select sum(id*count*age) from %v", c.queryTableName())
+	})), nil
 }
 
-func (c *StressCop) exec(genSQL func() string) error {
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		sql := genSQL()
-		_, err := db.Exec(sql)
-		if err != nil {
-			return err
-		}
+func (c *StressCop) exec(genSQL func() string) func(ctx context.Context, conn *sql.Conn) error {
+	return func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, genSQL())
+		return err
 	}
 }
 
-func (c *StressCop) print() error {
+func (c *StressCop) Report(ctx context.Context, env *cmd.CaseEnv) error {
 	start := time.Now()
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		time.Sleep(time.Second * time.Duration(c.interval))
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	for util.Sleep(ctx, time.Second*time.Duration(c.interval)) {
 		query := fmt.Sprintf("select avg(query_time),count(*) from information_schema.cluster_slow_query where db='%s' and query like 'select sum(id%%' and time > '%s' and time < now()", c.cfg.DBName, util.FormatTimeForQuery(start))
 		err := util.QueryAndPrintWithIgnoreZeroValue(db, query)
 		if err != nil {
@@ -227,4 +122,5 @@ func (c *StressCop) print() error {
 		}
 		fmt.Printf("---------------------------[ END ]-------------------------\n\n")
 	}
+	return nil
 }
@@ -1,95 +1,80 @@
 package test_case
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/crazycs520/testutil/cmd"
 	"github.com/crazycs520/testutil/config"
 	"github.com/crazycs520/testutil/util"
 	"github.com/spf13/cobra"
 	"math/rand"
-	"strings"
-	"sync/atomic"
 	"time"
 )
 
 type PessimisticWriteConflict struct {
+	cmd.BaseCase
 	cfg *config.Config
 
 	probability int
 	interval    int64
-	conflictErr int64
+	tracker     *updateTracker
 }
 
-func NewPessimisticWriteConflict(cfg *config.Config) cmd.CMDGenerater {
+func NewPessimisticWriteConflict(cfg *config.Config) cmd.Case {
 	return &PessimisticWriteConflict{
 		cfg: cfg,
 	}
 }
 
-func (c *PessimisticWriteConflict) Run() error {
-	db := util.GetSQLCli(c.cfg)
+func (c *PessimisticWriteConflict) Setup(ctx context.Context, env *cmd.CaseEnv) error {
+	fmt.Printf("probability: %v\nconcurrency: %v\n", c.probability, c.cfg.Concurrency)
+	if c.probability <= 0 {
+		return fmt.Errorf("probability should be positive")
+	}
+	c.tracker = newUpdateTracker(c.probability)
 	c.cfg.DBName = "write_conflict_pessimistic"
-	prepareSQLs := []string{
+	if !hasVar(c.cfg.SessionVars, "tidb_txn_mode") {
+		c.cfg.SessionVars = append(c.cfg.SessionVars, "tidb_txn_mode=pessimistic")
+	}
+	env.Runner.DefaultErrorPolicy(util.ErrClassWriteConflict, util.ErrPolicyContinue)
+	return env.Exec(ctx,
 		"drop table if exists t",
 		"create table t (id int, name varchar(10), count bigint, primary key (id))",
-		"set @@global.tidb_txn_mode='pessimistic'",
-	}
-	err := prepare(db, c.cfg.DBName, prepareSQLs)
+	)
+}
+
+func (c *PessimisticWriteConflict) Workers(env *cmd.CaseEnv, id int, conn *sql.Conn) (cmd.Worker, error) {
+	rnd := env.Rand(id)
+	return cmd.NewConnWorker(conn, func(ctx context.Context, conn *sql.Conn) error {
+		return c.update(ctx, conn, rnd)
+	}), nil
+}
+
+func (c *PessimisticWriteConflict) update(ctx context.Context, conn *sql.Conn, rnd *rand.Rand) error {
+	txn, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	db.Close()
-	for i := 0; i < c.cfg.Concurrency; i++ {
-		go func() {
-			err := c.update()
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-		}()
-	}
-	err = c.print()
+	id := rnd.Intn(c.probability)
+	sql := fmt.Sprintf("insert into t values (%v,'aaa', %v) on duplicate key update count=count+1;", id, 1)
+	_, err = txn.ExecContext(ctx, sql)
 	if err != nil {
-		fmt.Println(err.Error())
+		txn.Rollback()
+		return err
 	}
+	err = txn.Commit()
+	c.tracker.record(id, err)
 	return err
 }
 
-func (c *PessimisticWriteConflict) update() error {
-	db := util.GetSQLCli(c.cfg)
-	db.SetMaxOpenConns(1)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		_, err := db.Exec("commit")
-		if err != nil {
-			if strings.Contains(err.Error(), "Write conflict") {
-				atomic.AddInt64(&c.conflictErr, 1)
-				continue
-			}
-			return err
-		}
-		_, err = db.Exec("begin")
-		if err != nil {
-			return err
-		}
-		id := rand.Intn(c.probability)
-		sql := fmt.Sprintf("insert into t values (%v,'aaa', %v) on duplicate key update count=count+1;", id, 1)
-		_, err = db.Exec(sql)
-		if err != nil {
-			return err
-		}
-	}
-}
-
-func (c *PessimisticWriteConflict) print() error {
+func (c *PessimisticWriteConflict) Report(ctx context.Context, env *cmd.CaseEnv) error {
 	start := time.Now()
-	db := util.GetSQLCli(c.cfg)
-	defer func() {
-		db.Close()
-	}()
-	for {
-		time.Sleep(time.Second * time.Duration(c.interval))
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	for util.Sleep(ctx, time.Second*time.Duration(c.interval)) {
 		query := fmt.Sprintf("select avg(query_time),count(*) from information_schema.cluster_slow_query where db='%s' and query like 'insert into t%% on duplicate key update count%%' and time > '%s' and time < now()", c.cfg.DBName, util.FormatTimeForQuery(start))
 		err := util.QueryAndPrint(db, query)
 		if err != nil {
@@ -108,9 +93,20 @@ func (c *PessimisticWriteConflict) print() error {
 			return err
 		}
 		fmt.Println("------------------------")
-		fmt.Printf("conflict error count: %v \n", atomic.LoadInt64(&c.conflictErr))
+		fmt.Printf("conflict error count: %v \n", env.Runner.Recorder().ErrorCount(util.ErrClassWriteConflict))
 		fmt.Printf("---------------------------[ END ]-------------------------\n\n")
 	}
+	fmt.Printf("conflict error count: %v \n", env.Runner.Recorder().ErrorCount(util.ErrClassWriteConflict))
+	return nil
+}
+
+// Verify checks there is no lost or duplicated update.
+func (c *PessimisticWriteConflict) Verify(ctx context.Context, env *cmd.CaseEnv) error {
+	db, err := env.DB()
+	if err != nil {
+		return err
+	}
+	return c.tracker.verify(ctx, db, "t")
 }
 
 func (c *PessimisticWriteConflict) Cmd() *cobra.Command {
@@ -118,15 +114,9 @@ func (c *PessimisticWriteConflict) Cmd() *cobra.Command {
 		Use:          "write-conflict-pessimistic",
 		Short:        "test write conflict in pessimistic transaction case",
 		Long:         `test for write conflict in pessimistic transaction case`,
-		RunE:         c.RunE,
 		SilenceUsage: true,
 	}
 	cmd.Flags().IntVarP(&c.probability, "probability", "", 100, "conflict probability, rand( n )")
 	cmd.Flags().Int64VarP(&c.interval, "interval", "", 1, "print message interval seconds")
 	return cmd
 }
-
-func (c *PessimisticWriteConflict) RunE(cmd *cobra.Command, args []string) error {
-	fmt.Printf("probability: %v\nconcurrency: %v\n", c.probability, c.cfg.Concurrency)
-	return c.Run()
-}
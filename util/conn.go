@@ -0,0 +1,234 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The load balance policies of the endpoints.
+const (
+	LBRoundRobin = "round-robin"
+	LBRandom     = "random"
+	LBWeight     = "weight"
+)
+
+// ConnManager manages the connection pools of the endpoints in the config.
+// The workers which need their own session should pin a connection by Conn,
+// the endpoint of the connection is chosen by the load balance policy.
+type ConnManager struct {
+	endpoints []config.Endpoint
+	dbs       []*sql.DB
+	policy    string
+
+	mu  sync.Mutex
+	rr  int
+	rnd *rand.Rand
+	// current is the current weight of the smooth weighted round-robin.
+	current []int
+	// owners are the endpoint indexes of the pinned connections.
+	owners map[*sql.Conn]int
+}
+
+// NewConnManager creates the connection pools of cfg.DBName, the database should exist.
+func NewConnManager(cfg *config.Config) (*ConnManager, error) {
+	endpoints, err := cfg.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	policy := cfg.LoadBalance
+	if policy == "" {
+		policy = LBRoundRobin
+	}
+	if policy != LBRoundRobin && policy != LBRandom && policy != LBWeight {
+		return nil, fmt.Errorf("unknown load balance policy: %v, should be one of %v, %v, %v", policy, LBRoundRobin, LBRandom, LBWeight)
+	}
+	m := &ConnManager{
+		endpoints: endpoints,
+		policy:    policy,
+		current:   make([]int, len(endpoints)),
+		owners:    make(map[*sql.Conn]int),
+		rnd:       NewRand(cfg.Seed, -2),
+	}
+	for _, e := range endpoints {
+		db, err := OpenEndpointDB(cfg, e, cfg.DBName)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.dbs = append(m.dbs, db)
+	}
+	return m, nil
+}
+
+// DB returns the connection pool of the first endpoint.
+func (m *ConnManager) DB() *sql.DB {
+	return m.dbs[0]
+}
+
+// Endpoints returns the endpoints of the connection pools.
+func (m *ConnManager) Endpoints() []config.Endpoint {
+	return m.endpoints
+}
+
+// Conn returns a dedicated connection of the endpoint chosen by the load
+// balance policy, the caller should close it to return it to the pool.
+func (m *ConnManager) Conn(ctx context.Context) (*sql.Conn, error) {
+	idx := m.pick()
+	conn, err := m.dbs[idx].Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %v error: %w", m.endpoints[idx], err)
+	}
+	m.mu.Lock()
+	m.owners[conn] = idx
+	m.mu.Unlock()
+	return conn, nil
+}
+
+// Endpoint returns the endpoint of the connection returned by Conn.
+func (m *ConnManager) Endpoint(conn *sql.Conn) config.Endpoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.endpoints[m.owners[conn]]
+}
+
+func (m *ConnManager) pick() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.endpoints) == 1 {
+		return 0
+	}
+	switch m.policy {
+	case LBRandom:
+		return m.rnd.Intn(len(m.endpoints))
+	case LBWeight:
+		// smooth weighted round-robin, such as a, a, b, a for the weights 3 and 1.
+		total, best := 0, 0
+		for i, e := range m.endpoints {
+			m.current[i] += e.Weight
+			total += e.Weight
+			if m.current[i] > m.current[best] {
+				best = i
+			}
+		}
+		m.current[best] -= total
+		return best
+	default:
+		idx := m.rr % len(m.endpoints)
+		m.rr++
+		return idx
+	}
+}
+
+func (m *ConnManager) Close() error {
+	var firstErr error
+	for _, db := range m.dbs {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// OpenDB opens a connection pool of the first endpoint of cfg, it is used to
+// prepare the data and query the cluster information. The database of the
+// connections is dbName, empty dbName means no database is used, such as for
+// creating the database.
+func OpenDB(cfg *config.Config, dbName string) (*sql.DB, error) {
+	endpoints, err := cfg.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	return OpenEndpointDB(cfg, endpoints[0], dbName)
+}
+
+// OpenEndpointDB opens a connection pool of the endpoint, the session variables
+// and the init statements of cfg are executed on every new connection.
+func OpenEndpointDB(cfg *config.Config, endpoint config.Endpoint, dbName string) (*sql.DB, error) {
+	myCfg, err := mysqlConfig(cfg, endpoint, dbName)
+	if err != nil {
+		return nil, err
+	}
+	base, err := mysql.NewConnector(myCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection config: %v", err)
+	}
+	initSQL, err := SessionVarSQLs(cfg.SessionVars)
+	if err != nil {
+		return nil, err
+	}
+	initSQL = append(initSQL, cfg.InitSQL...)
+	db := sql.OpenDB(&connector{Connector: base, initSQL: initSQL})
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// mysqlConfig returns the driver config of the endpoint, the TLS config and
+// the extra DSN parameters of cfg are applied.
+func mysqlConfig(cfg *config.Config, endpoint config.Endpoint, dbName string) (*mysql.Config, error) {
+	myCfg := mysql.NewConfig()
+	myCfg.User = cfg.User
+	myCfg.Passwd = cfg.Password
+	myCfg.Net = endpoint.Net()
+	myCfg.Addr = endpoint.Addr()
+	myCfg.DBName = dbName
+	myCfg.Params = map[string]string{"charset": "utf8mb4"}
+	tlsName, err := registerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	myCfg.TLSConfig = tlsName
+	if len(cfg.DSNParams) == 0 {
+		return myCfg, nil
+	}
+	// the driver parses the parameters, such as timeout and interpolateParams, from the DSN.
+	params := make(url.Values, len(cfg.DSNParams))
+	for _, param := range cfg.DSNParams {
+		idx := strings.Index(param, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid dsn param: %v, should be name=value", param)
+		}
+		params.Set(param[:idx], param[idx+1:])
+	}
+	dsn := myCfg.FormatDSN() + "&" + params.Encode()
+	myCfg, err = mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn param %v: %v", cfg.DSNParams, err)
+	}
+	return myCfg, nil
+}
+
+// connector executes the init statements on every new connection.
+type connector struct {
+	driver.Connector
+	initSQL []string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range c.initSQL {
+		execer, ok := conn.(driver.ExecerContext)
+		if !ok {
+			conn.Close()
+			return nil, fmt.Errorf("the connection doesn't support executing the init statement: %v", s)
+		}
+		if _, err = execer.ExecContext(ctx, s, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init statement: %v, err: %w", s, err)
+		}
+	}
+	return conn, nil
+}
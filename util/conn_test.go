@@ -0,0 +1,54 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crazycs520/testutil/config"
+)
+
+// picks returns the hosts of the first n endpoints picked by the load balance
+// policy, the connection pools connect lazily so no server is needed.
+func picks(t *testing.T, hosts, policy string, n int) []string {
+	t.Helper()
+	cfg := &config.Config{DBConfig: config.DBConfig{Host: hosts, Port: 4000, LoadBalance: policy}}
+	m, err := NewConnManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	var picked []string
+	for i := 0; i < n; i++ {
+		picked = append(picked, m.Endpoints()[m.pick()].Host)
+	}
+	return picked
+}
+
+func TestLoadBalancePolicies(t *testing.T) {
+	if got := strings.Join(picks(t, "a,b,c", "", 7), " "); got != "a b c a b c a" {
+		t.Errorf("round-robin: %v", got)
+	}
+	// the smooth weighted round-robin interleaves the endpoints.
+	if got := strings.Join(picks(t, "a=3,b=1", LBWeight, 8), " "); got != "a a b a a a b a" {
+		t.Errorf("weight: %v", got)
+	}
+	if got := strings.Join(picks(t, "a=2,b=3,c=1", LBWeight, 6), " "); got != "b a b c a b" {
+		t.Errorf("weight: %v", got)
+	}
+	seen := make(map[string]int)
+	for _, host := range picks(t, "a,b,c", LBRandom, 300) {
+		seen[host]++
+	}
+	if len(seen) != 3 || seen["a"] < 50 || seen["b"] < 50 || seen["c"] < 50 {
+		t.Errorf("random: %v", seen)
+	}
+	// a single endpoint is always picked whatever the policy.
+	if got := strings.Join(picks(t, "a=5", LBRandom, 3), " "); got != "a a a" {
+		t.Errorf("single: %v", got)
+	}
+
+	cfg := &config.Config{DBConfig: config.DBConfig{Host: "a", LoadBalance: "least-conn"}}
+	if _, err := NewConnManager(cfg); err == nil {
+		t.Errorf("expect the unknown load balance policy error")
+	}
+}
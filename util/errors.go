@@ -0,0 +1,137 @@
+package util
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The error classes of ClassifyError.
+const (
+	ErrClassWriteConflict   = "write-conflict"
+	ErrClassDeadlock        = "deadlock"
+	ErrClassLockWaitTimeout = "lock-wait-timeout"
+	ErrClassTiKV            = "tikv"
+	ErrClassUndetermined    = "undetermined"
+	ErrClassUnknown         = "unknown"
+	ErrClassConnection      = "connection"
+	ErrClassOther           = "other"
+)
+
+// ErrClasses is all the error classes.
+var ErrClasses = []string{
+	ErrClassWriteConflict,
+	ErrClassDeadlock,
+	ErrClassLockWaitTimeout,
+	ErrClassTiKV,
+	ErrClassUndetermined,
+	ErrClassUnknown,
+	ErrClassConnection,
+	ErrClassOther,
+}
+
+// ErrCodeResultUndetermined is ErrResultUndetermined of TiDB, the transaction
+// may or may not have been committed.
+const ErrCodeResultUndetermined = 8224
+
+// The error policies of an error class.
+const (
+	// ErrPolicyContinue counts the error and goes on.
+	ErrPolicyContinue = "continue"
+	// ErrPolicyRetry counts the error and retries the operation.
+	ErrPolicyRetry = "retry"
+	// ErrPolicyAbort stops the run with the error.
+	ErrPolicyAbort = "abort"
+)
+
+// ClassifyError returns the class of err by the MySQL error number, or
+// ErrClassConnection if the connection is broken.
+func ClassifyError(err error) string {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch n := myErr.Number; {
+		case n == 9007:
+			return ErrClassWriteConflict
+		case n == 1213:
+			return ErrClassDeadlock
+		case n == 1205:
+			return ErrClassLockWaitTimeout
+		case n == 8027 || (n >= 9001 && n <= 9005):
+			return ErrClassTiKV
+		case n == ErrCodeResultUndetermined:
+			return ErrClassUndetermined
+		case n == 1105:
+			return ErrClassUnknown
+		}
+		return ErrClassOther
+	}
+	if isConnectionError(err) {
+		return ErrClassConnection
+	}
+	return ErrClassOther
+}
+
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// the driver may only return the message of the broken connection.
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
+
+// ErrorPolicy is the policy of every error class, the errors of the classes
+// which are not specified follow the Default policy.
+type ErrorPolicy struct {
+	Default string
+	Classes map[string]string
+}
+
+// NewErrorPolicy parses the policies of `class=policy`, the class `default`
+// sets the policy of the classes which are not specified.
+func NewErrorPolicy(policies map[string]string, defaultPolicy string) (*ErrorPolicy, error) {
+	p := &ErrorPolicy{Default: defaultPolicy, Classes: make(map[string]string, len(policies))}
+	for class, policy := range policies {
+		if policy != ErrPolicyContinue && policy != ErrPolicyRetry && policy != ErrPolicyAbort {
+			return nil, fmt.Errorf("unknown error policy: %v, should be one of %v, %v, %v", policy, ErrPolicyContinue, ErrPolicyRetry, ErrPolicyAbort)
+		}
+		if class == "default" {
+			p.Default = policy
+			continue
+		}
+		if !isErrClass(class) {
+			return nil, fmt.Errorf("unknown error class: %v, should be one of %v", class, strings.Join(ErrClasses, ", "))
+		}
+		p.Classes[class] = policy
+	}
+	return p, nil
+}
+
+func isErrClass(class string) bool {
+	for _, c := range ErrClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns the policy of the error class.
+func (p *ErrorPolicy) Policy(class string) string {
+	if policy, ok := p.Classes[class]; ok {
+		return policy
+	}
+	return p.Default
+}
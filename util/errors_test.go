@@ -0,0 +1,83 @@
+package util
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestClassifyMySQLErrors(t *testing.T) {
+	classes := map[uint16]string{
+		9007: ErrClassWriteConflict,
+		1213: ErrClassDeadlock,
+		1205: ErrClassLockWaitTimeout,
+		8027: ErrClassTiKV,
+		9001: ErrClassTiKV,
+		9003: ErrClassTiKV,
+		9005: ErrClassTiKV,
+		9006: ErrClassOther,
+		8224: ErrClassUndetermined,
+		1105: ErrClassUnknown,
+		1062: ErrClassOther,
+	}
+	for code, class := range classes {
+		err := &mysql.MySQLError{Number: code, Message: "error"}
+		if got := ClassifyError(err); got != class {
+			t.Errorf("error %v: expect %v, got %v", code, class, got)
+		}
+		// the statement errors are wrapped by the workers.
+		if got := ClassifyError(fmt.Errorf("exec: update t, err: %w", err)); got != class {
+			t.Errorf("wrapped error %v: expect %v, got %v", code, class, got)
+		}
+	}
+}
+
+func TestClassifyConnectionErrors(t *testing.T) {
+	for _, err := range []error{
+		driver.ErrBadConn,
+		mysql.ErrInvalidConn,
+		io.EOF,
+		fmt.Errorf("read: %w", io.ErrUnexpectedEOF),
+		&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+		syscall.ECONNRESET,
+		errors.New("write tcp 127.0.0.1:4000: broken pipe"),
+	} {
+		if got := ClassifyError(err); got != ErrClassConnection {
+			t.Errorf("%v: expect %v, got %v", err, ErrClassConnection, got)
+		}
+	}
+	if got := ClassifyError(errors.New("sql: no rows in result set")); got != ErrClassOther {
+		t.Errorf("expect %v, got %v", ErrClassOther, got)
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	p, err := NewErrorPolicy(map[string]string{
+		ErrClassDeadlock:   ErrPolicyRetry,
+		ErrClassConnection: ErrPolicyContinue,
+		"default":          ErrPolicyAbort,
+	}, ErrPolicyContinue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Policy(ErrClassDeadlock) != ErrPolicyRetry || p.Policy(ErrClassConnection) != ErrPolicyContinue {
+		t.Errorf("deadlock: %v, connection: %v", p.Policy(ErrClassDeadlock), p.Policy(ErrClassConnection))
+	}
+	// `default` overrides the default policy of the unspecified classes.
+	if p.Policy(ErrClassWriteConflict) != ErrPolicyAbort {
+		t.Errorf("write-conflict: %v", p.Policy(ErrClassWriteConflict))
+	}
+
+	if _, err := NewErrorPolicy(map[string]string{ErrClassDeadlock: "ignore"}, ErrPolicyContinue); err == nil {
+		t.Errorf("expect the unknown error policy error")
+	}
+	if _, err := NewErrorPolicy(map[string]string{"timeout": ErrPolicyRetry}, ErrPolicyContinue); err == nil {
+		t.Errorf("expect the unknown error class error")
+	}
+}
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"math/rand"
+)
+
+// NewRand returns the rand of the id derived from the seed, such as the rand
+// of the id-th worker. The same seed and id always generate the same sequence,
+// and the rand is not safe for concurrent use, every goroutine should have its own.
+func NewRand(seed int64, id int64) *rand.Rand {
+	return rand.New(rand.NewSource(mixSeed(seed, id)))
+}
+
+// mixSeed mixes the seed and the id by splitmix64, so the sequences of the
+// near ids are not correlated.
+func mixSeed(seed int64, id int64) int64 {
+	z := uint64(seed) + uint64(id+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
@@ -1,28 +1,14 @@
 package util
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/crazycs520/testutil/config"
-	"os"
 	"strings"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql" // mysql driver
 )
 
-func GetSQLCli(cfg *config.Config) *sql.DB {
-	dbDSN := fmt.Sprintf("%s:%s@tcp(%s:%d)/?charset=utf8mb4", cfg.User, cfg.Password, cfg.Host, cfg.Port)
-	db, err := sql.Open("mysql", dbDSN)
-	if err != nil {
-		fmt.Println("can not connect to database. err: " + err.Error())
-		os.Exit(1)
-	}
-	db.SetMaxOpenConns(1)
-	db.Exec("use " + cfg.DBName)
-	return db
-}
-
 func QueryRows(Engine *sql.DB, SQL string, fn func(row, cols []string) error) (err error) {
 	rows, err := Engine.Query(SQL)
 	if err == nil {
@@ -243,14 +229,28 @@ func FormatTimeForQuery(t time.Time) string {
 	return t.Format(TimeFSPFormat)
 }
 
-func PrintSlowQueryInfo(queryLike string, interval time.Duration, cfg *config.Config) error {
+// Sleep waits for the duration, it returns false if ctx is done before that.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func PrintSlowQueryInfo(ctx context.Context, queryLike string, interval time.Duration, cfg *config.Config) error {
 	start := time.Now()
-	db := GetSQLCli(cfg)
+	db, err := OpenDB(cfg, cfg.DBName)
+	if err != nil {
+		return err
+	}
 	defer func() {
 		db.Close()
 	}()
-	for {
-		time.Sleep(interval)
+	for Sleep(ctx, interval) {
 		fmt.Printf("\n---------------------------[ START ]-------------------------\n")
 		query := fmt.Sprintf("select avg(query_time),count(*) from information_schema.cluster_slow_query where db='%s' and query like '%v' and time > '%s' and time < now()", cfg.DBName, queryLike, FormatTimeForQuery(start))
 		err := QueryAndPrintWithIgnoreZeroValue(db, query)
@@ -265,4 +265,5 @@ func PrintSlowQueryInfo(queryLike string, interval time.Duration, cfg *config.Co
 		}
 		fmt.Printf("---------------------------[ END ]-------------------------\n\n")
 	}
+	return nil
 }
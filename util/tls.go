@@ -0,0 +1,107 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"io/ioutil"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The TLS modes of `--ssl-mode`, they are the same as the mysql client.
+const (
+	SSLModeDisabled       = "disabled"
+	SSLModePreferred      = "preferred"
+	SSLModeRequired       = "required"
+	SSLModeVerifyCA       = "verify-ca"
+	SSLModeVerifyIdentity = "verify-identity"
+)
+
+// tlsConfigName is the name of the TLS config registered to the mysql driver.
+const tlsConfigName = "testutil"
+
+// registerTLSConfig registers the TLS config of cfg to the mysql driver, and
+// returns the value of the `tls` DSN parameter.
+func registerTLSConfig(cfg *config.Config) (string, error) {
+	mode := cfg.SSLMode
+	if mode == "" {
+		switch {
+		case cfg.SSLCA != "":
+			mode = SSLModeVerifyCA
+		case cfg.SSLCert != "":
+			mode = SSLModeRequired
+		default:
+			mode = SSLModeDisabled
+		}
+	}
+	switch mode {
+	case SSLModeDisabled:
+		return "false", nil
+	case SSLModePreferred:
+		// the driver only falls back to the plain connection with its own TLS config.
+		if cfg.SSLCA != "" || cfg.SSLCert != "" || cfg.SSLKey != "" {
+			return "", fmt.Errorf("ssl mode %v doesn't support --ssl-ca, --ssl-cert and --ssl-key, use %v, %v or %v instead",
+				mode, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity)
+		}
+		return "preferred", nil
+	case SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+	default:
+		return "", fmt.Errorf("unknown ssl mode: %v, should be one of %v, %v, %v, %v, %v", mode,
+			SSLModeDisabled, SSLModePreferred, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity)
+	}
+
+	tlsCfg := &tls.Config{}
+	if cfg.SSLCert != "" || cfg.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.SSLCert, cfg.SSLKey)
+		if err != nil {
+			return "", fmt.Errorf("load client certificate error: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.SSLCA != "" {
+		pem, err := ioutil.ReadFile(cfg.SSLCA)
+		if err != nil {
+			return "", fmt.Errorf("read ssl ca error: %w", err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("no certificate is found in ssl ca %v", cfg.SSLCA)
+		}
+	} else if mode == SSLModeVerifyCA {
+		return "", fmt.Errorf("ssl mode %v needs --ssl-ca", mode)
+	}
+	switch mode {
+	case SSLModeRequired:
+		tlsCfg.InsecureSkipVerify = true
+	case SSLModeVerifyCA:
+		// verify the certificate chain only, the host name is not checked.
+		tlsCfg.InsecureSkipVerify = true
+		roots := tlsCfg.RootCAs
+		tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+			if len(certs) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+	// the mysql driver sets the server name of verify-identity by the host of every endpoint.
+	if err := mysql.RegisterTLSConfig(tlsConfigName, tlsCfg); err != nil {
+		return "", fmt.Errorf("register tls config error: %w", err)
+	}
+	return tlsConfigName, nil
+}
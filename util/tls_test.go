@@ -0,0 +1,34 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crazycs520/testutil/config"
+)
+
+func TestRegisterTLSConfigModes(t *testing.T) {
+	tlsParam := func(db config.DBConfig) (string, error) {
+		return registerTLSConfig(&config.Config{DBConfig: db})
+	}
+	if v, err := tlsParam(config.DBConfig{}); v != "false" || err != nil {
+		t.Errorf("default mode: expect tls=false, got %q, %v", v, err)
+	}
+	if v, err := tlsParam(config.DBConfig{SSLMode: SSLModePreferred}); v != "preferred" || err != nil {
+		t.Errorf("preferred mode: expect tls=preferred, got %q, %v", v, err)
+	}
+	for _, db := range []config.DBConfig{
+		{SSLMode: SSLModePreferred, SSLCA: "ca.pem"},
+		{SSLMode: SSLModePreferred, SSLCert: "client.pem", SSLKey: "client-key.pem"},
+	} {
+		if _, err := tlsParam(db); err == nil || !strings.Contains(err.Error(), "doesn't support --ssl-ca, --ssl-cert and --ssl-key") {
+			t.Errorf("preferred mode with %+v should be rejected, got %v", db, err)
+		}
+	}
+	if _, err := tlsParam(config.DBConfig{SSLMode: SSLModeVerifyCA}); err == nil || !strings.Contains(err.Error(), "needs --ssl-ca") {
+		t.Errorf("verify-ca without ca should be rejected, got %v", err)
+	}
+	if _, err := tlsParam(config.DBConfig{SSLMode: "on"}); err == nil || !strings.Contains(err.Error(), "unknown ssl mode") {
+		t.Errorf("unknown mode should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/crazycs520/testutil/config"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var varNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseVar parses the variable of `name=value`.
+func parseVar(nameValue string) (string, string, error) {
+	idx := strings.Index(nameValue, "=")
+	if idx < 0 {
+		return "", "", fmt.Errorf("invalid variable: %v, should be name=value", nameValue)
+	}
+	name := strings.TrimSpace(nameValue[:idx])
+	value := strings.TrimSpace(nameValue[idx+1:])
+	if !varNameRegexp.MatchString(name) {
+		return "", "", fmt.Errorf("invalid variable name: %v", name)
+	}
+	return name, value, nil
+}
+
+// varValue returns the literal of the variable value, the numbers and the
+// quoted values are used as is, the others are quoted as strings.
+func varValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value
+	}
+	return "'" + strings.Replace(strings.Replace(value, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
+
+// SessionVarSQLs returns the statements which set the session variables of `name=value`.
+func SessionVarSQLs(vars []string) ([]string, error) {
+	sqls := make([]string, 0, len(vars))
+	for _, v := range vars {
+		name, value, err := parseVar(v)
+		if err != nil {
+			return nil, err
+		}
+		sqls = append(sqls, fmt.Sprintf("set @@session.%v = %v", name, varValue(value)))
+	}
+	return sqls, nil
+}
+
+// SetGlobalVars sets the global variables of cfg, the returned function restores
+// the original values, it should be called before the program exits. The restore
+// is only done once, the later calls wait for the first one until ctx is done.
+func SetGlobalVars(cfg *config.Config) (func(ctx context.Context) error, error) {
+	restore := func(ctx context.Context) error { return nil }
+	if len(cfg.GlobalVars) == 0 {
+		return restore, nil
+	}
+	db, err := OpenDB(cfg, "")
+	if err != nil {
+		return restore, err
+	}
+	var names, origins []string
+	var started int32
+	done := make(chan struct{})
+	restore = func(ctx context.Context) error {
+		if !atomic.CompareAndSwapInt32(&started, 0, 1) {
+			select {
+			case <-done:
+			case <-ctx.Done():
+			}
+			return nil
+		}
+		defer close(done)
+		defer db.Close()
+		var firstErr error
+		for i := len(names) - 1; i >= 0; i-- {
+			_, err := db.ExecContext(ctx, fmt.Sprintf("set @@global.%v = %v", names[i], varValue(origins[i])))
+			if err != nil {
+				fmt.Printf("restore global variable %v to %v error: %v\n", names[i], origins[i], err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			fmt.Printf("restore global variable %v to %v\n", names[i], origins[i])
+		}
+		return firstErr
+	}
+	for _, v := range cfg.GlobalVars {
+		name, value, err := parseVar(v)
+		if err != nil {
+			return restore, err
+		}
+		var origin sql.NullString
+		err = db.QueryRow(fmt.Sprintf("select @@global.%v", name)).Scan(&origin)
+		if err != nil {
+			return restore, fmt.Errorf("get global variable %v error: %w", name, err)
+		}
+		_, err = db.Exec(fmt.Sprintf("set @@global.%v = %v", name, varValue(value)))
+		if err != nil {
+			return restore, fmt.Errorf("set global variable %v error: %w", name, err)
+		}
+		names = append(names, name)
+		origins = append(origins, origin.String)
+		fmt.Printf("set global variable %v to %v, the original value is %v\n", name, value, origin.String)
+	}
+	return restore, nil
+}